@@ -0,0 +1,112 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Accepts returns the offered media type which is most preferred
+// by the Accept header of the request, or an empty string if none
+// of the offered media types are acceptable. When several media
+// types are equally preferred, the first one offered is returned.
+// If the request has no Accept header, the first offer is returned.
+func (c *Context) Accepts(offers ...string) string {
+
+	head := c.Request().Header().Get(HeaderAccept)
+
+	if strings.TrimSpace(head) == "" {
+		if len(offers) > 0 {
+			return offers[0]
+		}
+		return ""
+	}
+
+	return negotiate(head, offers)
+
+}
+
+// negotiate selects the offer with the highest quality in the
+// Accept header, using the most specific media range which
+// matches each offer, so that `text/*;q=0` does not exclude
+// `text/plain` if `text/plain` is accepted explicitly.
+func negotiate(head string, offers []string) (best string) {
+
+	high := 0.0
+
+	for _, offer := range offers {
+
+		q, s := 0.0, -1
+
+		for _, part := range strings.Split(head, ",") {
+
+			rng, qual := accepted(part)
+
+			if n := specificity(rng, offer); n > s {
+				q, s = qual, n
+			}
+
+		}
+
+		if s >= 0 && q > high {
+			best, high = offer, q
+		}
+
+	}
+
+	return
+
+}
+
+// accepted parses a media range from the Accept header, and
+// returns it along with its quality, which defaults to 1.
+func accepted(part string) (rng string, q float64) {
+
+	q = 1
+
+	params := strings.Split(part, ";")
+
+	rng = strings.ToLower(strings.TrimSpace(params[0]))
+
+	for _, p := range params[1:] {
+		i := strings.IndexByte(p, '=')
+		if i > 0 && strings.EqualFold(strings.TrimSpace(p[:i]), "q") {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(p[i+1:]), 64); err == nil && f >= 0 && f <= 1 {
+				q = f
+			}
+		}
+	}
+
+	return
+
+}
+
+// specificity returns how specifically the media range matches
+// the media type, or -1 if the media range does not match it.
+func specificity(rng, typ string) int {
+
+	switch {
+	case rng == typ:
+		return 2
+	case rng == "*/*" || rng == "*":
+		return 0
+	case strings.HasSuffix(rng, "/*") && strings.HasPrefix(typ, rng[:len(rng)-1]):
+		return 1
+	}
+
+	return -1
+
+}
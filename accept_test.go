@@ -0,0 +1,108 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"mime"
+	"strings"
+	"testing"
+
+	"net/http/httptest"
+)
+
+func TestSend(t *testing.T) {
+
+	type item struct {
+		Name string `json:"name"`
+	}
+
+	tests := []struct {
+		name   string
+		def    string
+		data   interface{}
+		accept string
+		ctype  string
+		code   int
+		mime   string
+	}{
+		{name: "default", data: item{"a"}, code: 200, mime: "application/json"},
+		{name: "default type", def: "application/cbor", data: item{"a"}, code: 200, mime: "application/cbor"},
+		{name: "request type", data: item{"a"}, ctype: "application/msgpack", code: 200, mime: "application/msgpack"},
+		{name: "request type params", data: item{"a"}, ctype: "application/cbor; charset=utf-8", code: 200, mime: "application/cbor"},
+		{name: "request text struct", data: item{"a"}, ctype: "text/plain", code: 200, mime: "application/json"},
+		{name: "request text string", data: "a", ctype: "text/plain", code: 200, mime: "text/plain"},
+		{name: "request text bytes", data: []byte("a"), ctype: "text/plain", code: 200, mime: "text/plain"},
+		{name: "default text struct", def: "text/plain", data: item{"a"}, code: 200, mime: "application/json"},
+		{name: "accept exact", data: item{"a"}, accept: "application/xml", code: 200, mime: "application/xml"},
+		{name: "accept any", data: item{"a"}, accept: "*/*", ctype: "application/cbor", code: 200, mime: "application/cbor"},
+		{name: "accept quality", data: item{"a"}, accept: "application/cbor;q=0.5, application/msgpack", code: 200, mime: "application/msgpack"},
+		{name: "accept tie", data: item{"a"}, accept: "application/msgpack, application/cbor", ctype: "application/cbor", code: 200, mime: "application/cbor"},
+		{name: "accept excluded", data: item{"a"}, accept: "application/*;q=0.9, application/json;q=0", code: 200, mime: "application/cbor"},
+		{name: "accept specific", data: "a", accept: "text/*;q=0, text/plain", code: 200, mime: "text/plain"},
+		{name: "accept text struct", data: item{"a"}, accept: "text/plain", code: 406},
+		{name: "accept text string", data: "a", accept: "text/plain", code: 200, mime: "text/plain"},
+		{name: "accept unknown", data: item{"a"}, accept: "text/html", code: 406},
+		{name: "accept zero", data: item{"a"}, accept: "application/json;q=0", code: 406},
+	}
+
+	for _, test := range tests {
+
+		f := Server()
+
+		if test.def != "" {
+			f.SetDefaultType(test.def)
+		}
+
+		data := test.data
+
+		f.Post("/", func(c *Context) error {
+			return c.Send(200, data)
+		})
+
+		req := httptest.NewRequest(POST, "/", strings.NewReader(""))
+		if test.accept != "" {
+			req.Header.Set(HeaderAccept, test.accept)
+		}
+		if test.ctype != "" {
+			req.Header.Set("Content-Type", test.ctype)
+		}
+
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, req)
+
+		if res.Code != test.code {
+			t.Errorf("%s: expected code %d, got %d", test.name, test.code, res.Code)
+			continue
+		}
+
+		if v := res.Header().Get(HeaderVary); v != HeaderAccept {
+			t.Errorf("%s: expected Vary header %q, got %q", test.name, HeaderAccept, v)
+		}
+
+		if test.code != 200 {
+			continue
+		}
+
+		if typ, _, _ := mime.ParseMediaType(res.Header().Get("Content-Type")); typ != test.mime {
+			t.Errorf("%s: expected type %q, got %q", test.name, test.mime, typ)
+		}
+
+		if res.Body.Len() == 0 {
+			t.Errorf("%s: expected a response body, got none", test.name)
+		}
+
+	}
+
+}
@@ -0,0 +1,189 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// sources stores the struct tags which can be used to bind request
+// values to struct fields, along with how each source is described.
+var sources = [...][2]string{
+	{"param", "Parameter"},
+	{"query", "Query parameter"},
+	{"header", "Header"},
+	{"form", "Form field"},
+}
+
+// BindValues fills the fields of the struct with values from the
+// request, using the `param`, `query`, `header` and `form` struct
+// tags to specify where the value of each field is found. Values
+// are converted to the type of the field, and a `default` struct
+// tag can specify a value for a field which is not in the request.
+func (c *Context) BindValues(i interface{}) error {
+
+	v := reflect.ValueOf(i)
+
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	return c.bindValues(v.Elem())
+
+}
+
+func (c *Context) bindValues(v reflect.Value) error {
+
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+
+		field := t.Field(i)
+
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		src, name := "", ""
+
+		for _, s := range sources {
+			if tag := field.Tag.Get(s[0]); tag != "" && tag != "-" {
+				src, name = s[0], tag
+				break
+			}
+		}
+
+		fv := v.Field(i)
+
+		if src == "" {
+			if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+				if err := c.bindValues(fv); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		vals := c.values(src, name)
+
+		if len(vals) == 0 {
+			def, ok := field.Tag.Lookup("default")
+			if !ok || !fv.IsZero() {
+				continue
+			}
+			vals = []string{def}
+			if fv.Kind() == reflect.Slice {
+				vals = strings.Split(def, ",")
+			}
+		}
+
+		var raw interface{} = vals[0]
+
+		if fv.Kind() == reflect.Slice {
+			raw = vals
+		}
+
+		if err := convert(raw, fv.Addr().Interface()); err != nil {
+			return bindError(src, name, fv.Type())
+		}
+
+	}
+
+	return nil
+
+}
+
+// values returns the request values for the source and name.
+func (c *Context) values(src, name string) []string {
+	switch src {
+	case "param":
+		for i, n := range c.pnames {
+			if n == name {
+				return []string{c.pvalues[i]}
+			}
+		}
+	case "query":
+		return c.query[name]
+	case "header":
+		return c.Request().Header().Values(name)
+	case "form":
+		if c.request.Form == nil {
+			c.parseForm()
+		}
+		return c.request.Form[name]
+	}
+	return nil
+}
+
+// convert decodes the raw request value into the target, using weak
+// typing so that strings are converted to numbers and booleans.
+func convert(raw, out interface{}) error {
+
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           out,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToTimeHookFunc(time.RFC3339),
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	return dec.Decode(raw)
+
+}
+
+func bindError(src, name string, t reflect.Type) *HTTPError {
+
+	kind := "valid"
+
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		kind = "an integer"
+		if t == reflect.TypeOf(time.Duration(0)) {
+			kind = "a duration"
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		kind = "an unsigned integer"
+	case reflect.Float32, reflect.Float64:
+		kind = "a number"
+	case reflect.Bool:
+		kind = "a boolean"
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			kind = "a time"
+		}
+	}
+
+	for _, s := range sources {
+		if s[0] == src {
+			return NewHTTPError(400, fmt.Sprintf("%s '%s' must be %s", s[1], name, kind)).WithField(src, name)
+		}
+	}
+
+	return NewHTTPError(400)
+
+}
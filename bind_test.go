@@ -0,0 +1,135 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"net/http/httptest"
+)
+
+type testPage struct {
+	Page int `query:"page" default:"1"`
+}
+
+type testValues struct {
+	ID     int           `param:"id"`
+	Limit  int           `query:"limit" default:"10"`
+	Tags   []string      `query:"tag"`
+	Sort   []string      `query:"sort" default:"name,age"`
+	Active bool          `query:"active"`
+	Ratio  float64       `query:"ratio"`
+	Count  *uint         `query:"count"`
+	Wait   time.Duration `query:"wait"`
+	Since  time.Time     `query:"since"`
+	Token  string        `header:"X-Token"`
+	Name   string        `form:"name"`
+	Age    int           `form:"age"`
+	Skip   string        `query:"-"`
+	testPage
+}
+
+func TestBindValues(t *testing.T) {
+
+	f := Server()
+
+	var out testValues
+	var err error
+
+	f.Any("/b/:id", func(c *Context) error {
+		out = testValues{}
+		err = c.BindValues(&out)
+		return nil
+	})
+
+	three := uint(3)
+
+	tests := []struct {
+		meth  string
+		path  string
+		head  map[string]string
+		form  string
+		out   testValues
+		fail  string
+		field [2]string
+	}{
+		{
+			meth: GET, path: "/b/5",
+			out: testValues{ID: 5, Limit: 10, Sort: []string{"name", "age"}, testPage: testPage{1}},
+		},
+		{
+			meth: GET, path: "/b/5?limit=20&tag=a&tag=b&sort=id&active=1&ratio=0.5&count=3&wait=1m30s&since=2020-01-02T03:04:05Z&page=2&Skip=x",
+			head: map[string]string{"X-Token": "secret"},
+			out: testValues{
+				ID: 5, Limit: 20, Tags: []string{"a", "b"}, Sort: []string{"id"}, Active: true, Ratio: 0.5, Count: &three,
+				Wait: 90 * time.Second, Since: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Token: "secret", testPage: testPage{2},
+			},
+		},
+		{
+			meth: POST, path: "/b/5", form: "name=tobie&age=40",
+			out: testValues{ID: 5, Limit: 10, Sort: []string{"name", "age"}, Name: "tobie", Age: 40, testPage: testPage{1}},
+		},
+		{meth: GET, path: "/b/x", fail: "Parameter 'id' must be an integer", field: [2]string{"param", "id"}},
+		{meth: GET, path: "/b/5?limit=ten", fail: "Query parameter 'limit' must be an integer", field: [2]string{"query", "limit"}},
+		{meth: GET, path: "/b/5?active=maybe", fail: "Query parameter 'active' must be a boolean", field: [2]string{"query", "active"}},
+		{meth: GET, path: "/b/5?ratio=half", fail: "Query parameter 'ratio' must be a number", field: [2]string{"query", "ratio"}},
+		{meth: GET, path: "/b/5?count=-1", fail: "Query parameter 'count' must be an unsigned integer", field: [2]string{"query", "count"}},
+		{meth: GET, path: "/b/5?wait=soon", fail: "Query parameter 'wait' must be a duration", field: [2]string{"query", "wait"}},
+		{meth: GET, path: "/b/5?since=yesterday", fail: "Query parameter 'since' must be a time", field: [2]string{"query", "since"}},
+		{meth: GET, path: "/b/5?page=last", fail: "Query parameter 'page' must be an integer", field: [2]string{"query", "page"}},
+		{meth: POST, path: "/b/5", form: "age=old", fail: "Form field 'age' must be an integer", field: [2]string{"form", "age"}},
+	}
+
+	for _, test := range tests {
+
+		req := httptest.NewRequest(test.meth, test.path, strings.NewReader(test.form))
+		if test.form != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		for k, v := range test.head {
+			req.Header.Set(k, v)
+		}
+
+		f.ServeHTTP(httptest.NewRecorder(), req)
+
+		name := test.meth + " " + test.path
+
+		if test.fail == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", name, err)
+			} else if !reflect.DeepEqual(out, test.out) {
+				t.Errorf("%s: expected %+v, got %+v", name, test.out, out)
+			}
+			continue
+		}
+
+		he, ok := err.(*HTTPError)
+		if !ok {
+			t.Errorf("%s: expected an HTTPError, got %v", name, err)
+			continue
+		}
+		if he.Code() != 400 || he.Error() != test.fail {
+			t.Errorf("%s: expected 400 %q, got %d %q", name, test.fail, he.Code(), he.Error())
+		}
+		if he.Fields()[test.field[0]] != test.field[1] {
+			t.Errorf("%s: expected field %s=%s, got %v", name, test.field[0], test.field[1], he.Fields())
+		}
+
+	}
+
+}
@@ -15,15 +15,19 @@
 package fibre
 
 import (
-	"encoding/xml"
-	"github.com/gorilla/websocket"
-	"github.com/ugorji/go/codec"
+	"context"
+	"sync"
+	"time"
+
 	"net/http"
+
+	"github.com/gorilla/websocket"
 )
 
 // Socket wraps an websocket.Conn
 type Client struct {
 	*websocket.Conn
+	codecs *Codecs
 }
 
 // NewClient creates a new instance of Response.
@@ -40,12 +44,19 @@ func NewClient(url string, protocols []string) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{con}, nil
+	return &Client{con, NewCodecs()}, nil
+
+}
 
+// Codecs returns the codec registry used by the client.
+func (c *Client) Codecs() *Codecs {
+	return c.codecs
 }
 
+// Close sends a close message to the socket. It can be called
+// concurrently with any of the methods which write to the socket.
 func (c *Client) Close() error {
-	return c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	return c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
 }
 
 // Read reads a message from the socket.
@@ -55,38 +66,22 @@ func (c *Client) Read() (int, []byte, error) {
 
 // ReadXML reads a xml message from the socket.
 func (c *Client) ReadXML(v interface{}) (err error) {
-	_, r, err := c.NextReader()
-	if err != nil {
-		return err
-	}
-	return xml.NewDecoder(r).Decode(v)
+	return c.read("application/xml", v)
 }
 
 // ReadJSON reads a json message from the socket.
 func (c *Client) ReadJSON(v interface{}) (err error) {
-	_, r, err := c.NextReader()
-	if err != nil {
-		return err
-	}
-	return codec.NewDecoder(r, &jh).Decode(v)
+	return c.read("application/json", v)
 }
 
 // ReadCBOR reads a cbor message from the socket.
 func (c *Client) ReadCBOR(v interface{}) (err error) {
-	_, r, err := c.NextReader()
-	if err != nil {
-		return err
-	}
-	return codec.NewDecoder(r, &ch).Decode(v)
+	return c.read("application/cbor", v)
 }
 
 // ReadPACK reads a msgpack message from the socket.
 func (c *Client) ReadPACK(v interface{}) (err error) {
-	_, r, err := c.NextReader()
-	if err != nil {
-		return err
-	}
-	return codec.NewDecoder(r, &mh).Decode(v)
+	return c.read("application/msgpack", v)
 }
 
 // Send sends a response to the socket.
@@ -101,119 +96,73 @@ func (c *Client) SendText(data string) (err error) {
 
 // SendXML sends a xml response with status code.
 func (c *Client) SendXML(data interface{}) (err error) {
-	w, err := c.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
-	}
-	if data != nil {
-		xml.NewEncoder(w).Encode(data)
-	}
-	return w.Close()
+	return c.write("application/xml", data)
 }
 
 // SendJSON sends a json response with status code.
 func (c *Client) SendJSON(data interface{}) (err error) {
-	w, err := c.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
-	}
-	if data != nil {
-		codec.NewEncoder(w, &jh).Encode(data)
-	}
-	return w.Close()
+	return c.write("application/json", data)
 }
 
 // SendCBOR sends a cbor response with status code.
 func (c *Client) SendCBOR(data interface{}) (err error) {
-	w, err := c.NextWriter(websocket.BinaryMessage)
-	if err != nil {
-		return err
-	}
-	if data != nil {
-		codec.NewEncoder(w, &ch).Encode(data)
-	}
-	return w.Close()
+	return c.write("application/cbor", data)
 }
 
 // SendPACK sends a msgpack response with status code.
 func (c *Client) SendPACK(data interface{}) (err error) {
-	w, err := c.NextWriter(websocket.BinaryMessage)
-	if err != nil {
-		return err
-	}
-	if data != nil {
-		codec.NewEncoder(w, &mh).Encode(data)
-	}
-	return w.Close()
+	return c.write("application/msgpack", data)
 }
 
+// Rpc starts reading responses from, and writing requests to, the
+// socket. Both loops stop as soon as the connection drops.
 func (c *Client) Rpc() (chan<- *RPCRequest, <-chan *RPCResponse, chan error) {
 
 	send := make(chan *RPCRequest)
 	recv := make(chan *RPCResponse)
 	quit := make(chan error, 1)
-	exit := make(chan int, 1)
-	kind := c.Subprotocol()
+	once := sync.Once{}
+	mime, _ := c.Codecs().Protocol(c.Subprotocol())
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stop := func(err error) {
+		once.Do(func() {
+			c.Close()
+			quit <- err
+			cancel()
+		})
+	}
 
 	go func() {
-	loop:
 		for {
-			select {
-			case <-exit:
-				break loop
-			default:
-
-				var err error
-				var req RPCResponse
-
-				switch kind {
-				case "json":
-					err = c.ReadJSON(&req)
-				case "cbor":
-					err = c.ReadCBOR(&req)
-				case "pack":
-					err = c.ReadPACK(&req)
-				}
 
-				if err != nil {
-					c.Close()
-					quit <- err
-					exit <- 0
-					break loop
-				}
+			var res RPCResponse
 
-				recv <- &req
+			if err := c.read(mime, &res); err != nil {
+				stop(err)
+				return
+			}
 
+			select {
+			case <-ctx.Done():
+				return
+			case recv <- &res:
 			}
+
 		}
 	}()
 
 	go func() {
-	loop:
 		for {
 			select {
-			case <-exit:
-				break loop
-			case res := <-send:
-
-				var err error
-
-				switch kind {
-				case "json":
-					err = c.SendJSON(res)
-				case "cbor":
-					err = c.SendCBOR(res)
-				case "pack":
-					err = c.SendPACK(res)
-				}
-
-				if err != nil {
-					c.Close()
-					quit <- err
-					exit <- 0
-					break loop
+			case <-ctx.Done():
+				return
+			case req := <-send:
+				if err := c.write(mime, req); err != nil {
+					stop(err)
+					return
 				}
-
 			}
 		}
 	}()
@@ -221,3 +170,11 @@ func (c *Client) Rpc() (chan<- *RPCRequest, <-chan *RPCResponse, chan error) {
 	return send, recv, quit
 
 }
+
+func (c *Client) read(mime string, v interface{}) error {
+	return readMessage(c.Conn, c.codecs, mime, v)
+}
+
+func (c *Client) write(mime string, data interface{}) error {
+	return writeMessage(c.Conn, c.codecs, mime, data)
+}
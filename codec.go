@@ -15,44 +15,242 @@
 package fibre
 
 import (
+	"fmt"
+	"io"
 	"reflect"
+	"strings"
+	"time"
+
+	"encoding/xml"
 
 	"github.com/ugorji/go/codec"
 )
 
-var (
-	jh codec.JsonHandle
-	ch codec.CborHandle
-	mh codec.MsgpackHandle
-)
+// CodecOpts stores the options used by the json, cbor and msgpack
+// codecs. Canonical sorts map keys so that encoded output is stable,
+// at the expense of speed. MapType and SliceType specify the types
+// used when decoding maps and arrays into an empty interface, and
+// TimeRFC3339 encodes cbor times as strings rather than as epochs.
+// Extensions specify custom encodings for the specified types.
+type CodecOpts struct {
+	Canonical   bool
+	MapType     reflect.Type
+	SliceType   reflect.Type
+	TimeRFC3339 bool
+	Extensions  []CodecExt
+}
+
+// CodecExt stores a custom encoding for a type, along with the
+// tag used to identify the type in cbor and msgpack output, which
+// must be below 128. Extensions can not be used for time.Time,
+// which each codec encodes natively, and Configure returns an
+// error for any such extension.
+type CodecExt struct {
+	Type reflect.Type
+	Tag  uint64
+	Ext  codec.Ext
+}
+
+// DefaultCodecOpts returns the codec options used by default.
+func DefaultCodecOpts() CodecOpts {
+	return CodecOpts{
+		Canonical: true,
+		MapType:   reflect.TypeOf(map[string]interface{}(nil)),
+		SliceType: reflect.TypeOf([]interface{}(nil)),
+	}
+}
+
+// Codec encodes and decodes values for a media type.
+type Codec interface {
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+// Codecs stores the codecs used for request and response bodies,
+// keyed by media type, and for websocket messages, keyed by the
+// name of the websocket subprotocol.
+type Codecs struct {
+	types  []string
+	protos []string
+	byType map[string]Codec
+	byName map[string]string
+}
+
+// NewCodecs creates a codec registry with the default codecs
+// for json, cbor, msgpack, and xml already registered.
+func NewCodecs() *Codecs {
+	c := &Codecs{
+		byType: make(map[string]Codec),
+		byName: make(map[string]string),
+	}
+	c.Configure(DefaultCodecOpts())
+	c.Register("application/xml", XMLCodec())
+	return c
+}
 
-func init() {
+// Configure replaces the json, cbor and msgpack codecs with
+// codecs which use the options. Any other codecs are kept.
+func (c *Codecs) Configure(opts CodecOpts) error {
+
+	var jh codec.JsonHandle
+	var ch codec.CborHandle
+	var mh codec.MsgpackHandle
 
 	// JsonHandle
 
-	jh.Canonical = true
+	jh.Canonical = opts.Canonical
 	jh.InternString = true
 	jh.HTMLCharsAsIs = true
 	jh.CheckCircularRef = false
-	jh.SliceType = reflect.TypeOf([]interface{}(nil))
-	jh.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	jh.SliceType = opts.SliceType
+	jh.MapType = opts.MapType
 
 	// CborHandle
 
-	ch.Canonical = true
+	ch.Canonical = opts.Canonical
 	ch.InternString = true
 	ch.CheckCircularRef = false
-	ch.SliceType = reflect.TypeOf([]interface{}(nil))
-	ch.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	ch.SliceType = opts.SliceType
+	ch.MapType = opts.MapType
+	ch.TimeRFC3339 = opts.TimeRFC3339
 
 	// MsgpackHandle
 
 	mh.WriteExt = true
-	mh.Canonical = true
+	mh.Canonical = opts.Canonical
 	mh.RawToString = true
 	mh.InternString = true
 	mh.CheckCircularRef = false
-	mh.SliceType = reflect.TypeOf([]interface{}(nil))
-	mh.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	mh.SliceType = opts.SliceType
+	mh.MapType = opts.MapType
+
+	// Extensions
+
+	for _, e := range opts.Extensions {
+		if e.Type == nil {
+			return fmt.Errorf("codec extension tag %d has no type", e.Tag)
+		}
+		if e.Tag > 127 {
+			return fmt.Errorf("codec extension tag %d for %s is above 127", e.Tag, e.Type)
+		}
+		if native(e.Type) {
+			return fmt.Errorf("codec extension for %s is not supported, as it is encoded natively", e.Type)
+		}
+		if err := jh.SetInterfaceExt(e.Type, e.Tag, e.Ext); err != nil {
+			return err
+		}
+		if err := ch.SetInterfaceExt(e.Type, e.Tag, e.Ext); err != nil {
+			return err
+		}
+		if err := mh.SetBytesExt(e.Type, e.Tag, e.Ext); err != nil {
+			return err
+		}
+	}
+
+	c.Register("application/json", HandleCodec(&jh), "json")
+	c.Register("application/cbor", HandleCodec(&ch), "cbor")
+	c.Register("application/msgpack", HandleCodec(&mh), "pack")
+	c.Register("application/vnd.api+json", HandleCodec(&jh))
+
+	return nil
+
+}
+
+// Register adds a codec for the media type, replacing any codec
+// already registered for it. The codec is also used for websocket
+// connections which use any of the specified subprotocols.
+func (c *Codecs) Register(mime string, codec Codec, protocols ...string) {
+
+	mime = strings.ToLower(mime)
+
+	if _, ok := c.byType[mime]; !ok {
+		c.types = append(c.types, mime)
+	}
+
+	c.byType[mime] = codec
+
+	for _, p := range protocols {
+		if _, ok := c.byName[p]; !ok {
+			c.protos = append(c.protos, p)
+		}
+		c.byName[p] = mime
+	}
+
+}
+
+// Type returns the codec for the media type, or nil if no codec
+// has been registered for the media type.
+func (c *Codecs) Type(mime string) Codec {
+	return c.byType[strings.ToLower(mime)]
+}
+
+// Protocol returns the media type and the codec for the websocket
+// subprotocol, or nil if no codec has been registered for it.
+func (c *Codecs) Protocol(name string) (string, Codec) {
+	mime := c.byName[name]
+	return mime, c.byType[mime]
+}
+
+// Types returns the registered media types in registration order.
+func (c *Codecs) Types() []string {
+	return append([]string(nil), c.types...)
+}
+
+// Protocols returns the registered websocket subprotocols in
+// registration order.
+func (c *Codecs) Protocols() []string {
+	return append([]string(nil), c.protos...)
+}
+
+// HandleCodec returns a codec which uses the ugorji codec handle.
+func HandleCodec(h codec.Handle) Codec {
+	return handleCodec{h}
+}
+
+type handleCodec struct {
+	h codec.Handle
+}
+
+func (c handleCodec) Encode(w io.Writer, v interface{}) error {
+	return codec.NewEncoder(w, c.h).Encode(v)
+}
+
+func (c handleCodec) Decode(r io.Reader, v interface{}) error {
+	return codec.NewDecoder(r, c.h).Decode(v)
+}
+
+// XMLCodec returns a codec which uses the encoding/xml package.
+func XMLCodec() Codec {
+	return xmlCodec{}
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) Encode(w io.Writer, v interface{}) error {
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func (xmlCodec) Decode(r io.Reader, v interface{}) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// native returns whether the type, or the type it points to, is
+// encoded natively by the codecs, which ignore any extension for it.
+func native(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(codec.Raw(nil)), reflect.TypeOf(codec.RawExt{}):
+		return true
+	}
+	return false
+}
 
+// textual returns whether messages of the media type should be
+// sent as websocket text messages rather than binary messages.
+func textual(mime string) bool {
+	return strings.HasPrefix(mime, "text/") ||
+		strings.HasSuffix(mime, "/json") || strings.HasSuffix(mime, "+json") ||
+		strings.HasSuffix(mime, "/xml") || strings.HasSuffix(mime, "+xml")
 }
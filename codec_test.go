@@ -0,0 +1,117 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testID is encoded as a number using a codec extension.
+type testID string
+
+type testIDExt struct{}
+
+func (testIDExt) WriteExt(v interface{}) []byte {
+	return []byte(idValue(v))
+}
+
+func (testIDExt) ReadExt(dst interface{}, src []byte) {
+	*(dst.(*testID)) = testID(src)
+}
+
+func (testIDExt) ConvertExt(v interface{}) interface{} {
+	n, _ := strconv.Atoi(string(idValue(v)))
+	return n
+}
+
+func (testIDExt) UpdateExt(dst interface{}, src interface{}) {
+	*(dst.(*testID)) = testID(fmt.Sprint(src))
+}
+
+func idValue(v interface{}) testID {
+	if p, ok := v.(*testID); ok {
+		return *p
+	}
+	return v.(testID)
+}
+
+func TestCodecsConfigure(t *testing.T) {
+
+	tests := []struct {
+		name string
+		ext  CodecExt
+		fail bool
+	}{
+		{"custom type", CodecExt{Type: reflect.TypeOf(testID("")), Tag: 1, Ext: testIDExt{}}, false},
+		{"tag above 127", CodecExt{Type: reflect.TypeOf(testID("")), Tag: 128, Ext: testIDExt{}}, true},
+		{"missing type", CodecExt{Tag: 1, Ext: testIDExt{}}, true},
+		{"time", CodecExt{Type: reflect.TypeOf(time.Time{}), Tag: 1, Ext: testIDExt{}}, true},
+		{"time pointer", CodecExt{Type: reflect.TypeOf(&time.Time{}), Tag: 1, Ext: testIDExt{}}, true},
+	}
+
+	for _, test := range tests {
+		opts := DefaultCodecOpts()
+		opts.Extensions = []CodecExt{test.ext}
+		err := NewCodecs().Configure(opts)
+		if test.fail && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if !test.fail && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+
+}
+
+func TestCodecsExtension(t *testing.T) {
+
+	c := NewCodecs()
+
+	opts := DefaultCodecOpts()
+	opts.Extensions = []CodecExt{{Type: reflect.TypeOf(testID("")), Tag: 1, Ext: testIDExt{}}}
+
+	if err := c.Configure(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mime := range []string{"application/json", "application/cbor", "application/msgpack"} {
+
+		var buf bytes.Buffer
+		var out struct{ ID testID }
+
+		if err := c.Type(mime).Encode(&buf, struct{ ID testID }{"42"}); err != nil {
+			t.Fatalf("%s: %v", mime, err)
+		}
+
+		if mime == "application/json" && buf.String() != `{"ID":42}` {
+			t.Errorf("%s: expected the extension to be used, got %s", mime, buf.String())
+		}
+
+		if err := c.Type(mime).Decode(&buf, &out); err != nil {
+			t.Fatalf("%s: %v", mime, err)
+		}
+
+		if out.ID != "42" {
+			t.Errorf("%s: expected %q, got %q", mime, "42", out.ID)
+		}
+
+	}
+
+}
@@ -19,7 +19,6 @@ import (
 	"mime"
 	"net"
 	"os"
-	"strings"
 	"time"
 
 	"io/ioutil"
@@ -32,7 +31,6 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/mitchellh/mapstructure"
 	"github.com/segmentio/ksuid"
-	"github.com/ugorji/go/codec"
 )
 
 // Context represents context for the current request.
@@ -41,12 +39,15 @@ type Context struct {
 	socket   *Socket
 	request  *Request
 	response *Response
-	ctx      context.Context
 	uniq     string
 	path     string
-	param    url.Values
+	allow    string
+	pnames   []string
+	pvalues  []string
 	query    url.Values
 	store    map[string]interface{}
+	cleanup  []func()
+	gate     *gate
 }
 
 // NewContext creates a Context object.
@@ -55,21 +56,110 @@ func NewContext(req *Request, res *Response, f *Fibre) *Context {
 		fibre:    f,
 		request:  req,
 		response: res,
+		pnames:   make([]string, 0, 8),
+		pvalues:  make([]string, 0, 8),
 	}
 }
 
+// Context returns the context of the request, which is cancelled
+// when the client goes away, or when the request has been handled.
 func (c *Context) Context() context.Context {
-	if c.ctx != nil {
-		return c.ctx
+	if c.request == nil || c.request.Request == nil {
+		return context.Background()
 	}
-	return context.Background()
+	return c.request.Request.Context()
 }
 
+// WithContext sets the context of the request, replacing the
+// underlying http.Request with a copy which uses the context.
 func (c *Context) WithContext(ctx context.Context) *Context {
-	n := new(Context)
-	*n = *c
-	n.ctx = ctx
+	c.request.Request = c.request.Request.WithContext(ctx)
+	return c
+}
+
+// Clone returns a copy of the context, which is not returned to the
+// pool once the request has been handled, so that it can be used in
+// a goroutine which outlives the handler. The request data, params,
+// query, store and uniq id are copied. Once the request is finished,
+// the context of the copy is cancelled, and anything written to its
+// response is dropped, with writes returning an error.
+func (c *Context) Clone() *Context {
+
+	n := &Context{
+		fibre:   c.fibre,
+		socket:  c.socket,
+		uniq:    c.uniq,
+		path:    c.path,
+		allow:   c.allow,
+		pnames:  append([]string(nil), c.pnames...),
+		pvalues: append([]string(nil), c.pvalues...),
+		query:   make(url.Values, len(c.query)),
+	}
+
+	for k, v := range c.query {
+		n.query[k] = append([]string(nil), v...)
+	}
+
+	if c.store != nil {
+		n.store = make(map[string]interface{}, len(c.store))
+		for k, v := range c.store {
+			n.store[k] = v
+		}
+	}
+
+	if c.request != nil {
+		n.request = &Request{fibre: c.request.fibre, start: c.request.start}
+		if c.request.Request != nil {
+			n.request.Request = c.request.Request.WithContext(c.request.Request.Context())
+		}
+	}
+
+	// The clones of a context share a gate, which is closed
+	// once the request has finished, so that a clone can not
+	// write to a response which the server has already sent
+	if c.response != nil {
+		if c.gate == nil {
+			c.gate = new(gate)
+			c.onFinish(c.gate.close)
+		}
+		w := c.response.ResponseWriter
+		if v, ok := w.(*clonedWriter); ok {
+			w = v.ResponseWriter
+		}
+		n.gate = c.gate
+		n.response = &Response{
+			ResponseWriter: &clonedWriter{ResponseWriter: w, gate: c.gate},
+			fibre:          c.response.fibre,
+			size:           c.response.size,
+			status:         c.response.status,
+			done:           c.response.done,
+		}
+	}
+
 	return n
+
+}
+
+// Detach returns a copy of the context for background work which
+// continues after the request has finished. Unlike Clone, the copy
+// has a context which is never cancelled, although it keeps all of
+// the context values, and anything written to its response is
+// discarded rather than being sent to the client.
+func (c *Context) Detach() *Context {
+
+	n := c.Clone()
+
+	if n.request != nil && n.request.Request != nil {
+		n.request.Request = n.request.Request.WithContext(detached{n.Context()})
+	}
+
+	if n.response != nil {
+		n.response.ResponseWriter = &discard{header: n.response.Header().Clone()}
+		n.response.done = true
+	}
+
+	return n
+
 }
 
 // Fibre returns the fibre instance.
@@ -160,7 +250,12 @@ func (c *Context) Form(name string) (v string) {
 
 // Param returns path parameter by name.
 func (c *Context) Param(name string) (v string) {
-	return c.param.Get(name)
+	for i, n := range c.pnames {
+		if n == name {
+			return c.pvalues[i]
+		}
+	}
+	return
 }
 
 // Query returns query parameter by name.
@@ -240,57 +335,85 @@ func (c *Context) XML(code int, data interface{}) (err error) {
 		c.response.Write([]byte(xml.Header))
 	}
 	if data != nil {
-		return xml.NewEncoder(c.response).Encode(data)
+		return c.fibre.codecs.Type("application/xml").Encode(c.response, data)
 	}
 	return
 }
 
 // JSON sends a json response with status code.
 func (c *Context) JSON(code int, data interface{}) (err error) {
-	c.response.Header().Set("Content-Type", "application/json; charset=utf-8")
-	c.response.WriteHeader(code)
-	if data != nil {
-		return codec.NewEncoder(c.response, &jh).Encode(data)
-	}
-	return
+	return c.Encode(code, "application/json", data)
 }
 
 // CBOR sends a cbor response with status code.
 func (c *Context) CBOR(code int, data interface{}) (err error) {
-	c.response.Header().Set("Content-Type", "application/cbor; charset=utf-8")
-	c.response.WriteHeader(code)
-	if data != nil {
-		return codec.NewEncoder(c.response, &ch).Encode(data)
-	}
-	return
+	return c.Encode(code, "application/cbor", data)
 }
 
 // PACK sends a msgpack response with status code.
 func (c *Context) PACK(code int, data interface{}) (err error) {
-	c.response.Header().Set("Content-Type", "application/msgpack; charset=utf-8")
+	return c.Encode(code, "application/msgpack", data)
+}
+
+// Encode sends a response with status code, using the codec
+// which has been registered for the mime type to encode it.
+func (c *Context) Encode(code int, mime string, data interface{}) (err error) {
+	cod := c.fibre.codecs.Type(mime)
+	if cod == nil {
+		return NewHTTPError(406)
+	}
+	c.response.Header().Set("Content-Type", mime+"; charset=utf-8")
 	c.response.WriteHeader(code)
 	if data != nil {
-		return codec.NewEncoder(c.response, &mh).Encode(data)
+		return cod.Encode(c.response, data)
 	}
 	return
 }
 
-// Send sends the relevant response depending on the request type.
+// Send sends the relevant response depending on the Accept header
+// of the request. When several types are equally acceptable, or
+// when the request has no Accept header, the type of the request
+// body is preferred, followed by the default type of the server.
+// If none of the supported types are acceptable, a 406 is returned.
+// A text/plain response is only offered for string or []byte data.
 func (c *Context) Send(code int, data interface{}) (err error) {
-	switch c.Type() {
-	default:
+
+	types := c.fibre.codecs.Types()
+
+	switch data.(type) {
+	case string, []byte:
+		types = append(types, "text/plain")
+	}
+
+	offers := make([]string, 0, len(types)+2)
+
+	for _, v := range types {
+		if v == c.Type() {
+			offers = append(offers, v)
+		}
+	}
+
+	for _, v := range types {
+		if v == c.fibre.mime {
+			offers = append(offers, v)
+		}
+	}
+
+	offers = append(offers, types...)
+
+	c.response.Header().Add(HeaderVary, HeaderAccept)
+
+	switch mime := c.Accepts(offers...); mime {
+	case "":
+		return NewHTTPError(406)
+	case "text/plain":
 		return c.Text(code, data)
 	case "application/xml":
 		return c.XML(code, data)
-	case "application/json":
-		return c.JSON(code, data)
-	case "application/cbor":
-		return c.CBOR(code, data)
-	case "application/msgpack":
-		return c.PACK(code, data)
-	case "application/vnd.api+json":
-		return c.JSON(code, data)
+	default:
+		return c.Encode(code, mime, data)
 	}
+
 }
 
 // File sends a response with the content of a file.
@@ -321,29 +444,26 @@ func (c *Context) File(path string) (err error) {
 
 }
 
-// Bind decodes the request body into the object.
+// Bind decodes the request body into the object, using the
+// codec which has been registered for the request content type,
+// then fills any fields bound to request values using BindValues,
+// and then checks the object using any `validate` struct tags.
 func (c *Context) Bind(i interface{}) (err error) {
-	switch c.Type() {
-	case "application/xml":
-		if err = xml.NewDecoder(c.Request().Body).Decode(i); err != nil {
-			err = NewHTTPError(400, err.Error())
-		}
-	case "application/json":
-		if err = codec.NewDecoder(c.Request().Body, &jh).Decode(i); err != nil {
-			err = NewHTTPError(400, err.Error())
-		}
-	case "application/cbor":
-		if err = codec.NewDecoder(c.Request().Body, &ch).Decode(i); err != nil {
-			err = NewHTTPError(400, err.Error())
-		}
-	case "application/msgpack":
-		if err = codec.NewDecoder(c.Request().Body, &mh).Decode(i); err != nil {
-			err = NewHTTPError(400, err.Error())
-		}
-	case "application/x-www-form-urlencoded":
+	if err = c.decode(i); err != nil {
+		return
+	}
+	if err = c.BindValues(i); err != nil {
+		return
+	}
+	return c.Validate(i)
+}
+
+func (c *Context) decode(i interface{}) (err error) {
+	switch mime := c.Type(); mime {
+	case "application/x-www-form-urlencoded", "multipart/form-data":
 		obj := map[string]interface{}{}
-		if err = c.request.ParseForm(); err != nil {
-			err = NewHTTPError(400, err.Error())
+		if err = c.parseForm(); err != nil {
+			return
 		}
 		for k, v := range c.request.Form {
 			if len(v) == 1 {
@@ -352,49 +472,36 @@ func (c *Context) Bind(i interface{}) (err error) {
 				obj[k] = v
 			}
 		}
-		if err = mapstructure.Decode(obj, i); err != nil {
+		if err = mapstructure.WeakDecode(obj, i); err != nil {
 			err = NewHTTPError(400, err.Error())
 		}
+	default:
+		if cod := c.fibre.codecs.Type(mime); cod != nil {
+			if err = cod.Decode(c.Request().Body, i); err != nil {
+				err = NewHTTPError(400, err.Error())
+			}
+		}
 	}
 	return
 }
 
-// IP returns the ip address belonging to this context.
+// IP returns the ip address of the client. Forwarding headers are
+// only used when the request comes from a trusted proxy.
 func (c *Context) IP() net.IP {
+	return c.request.origin().ip
+}
 
-	var i int
-	var s string
-
-	s = "X-Real-IP"
-	for i = 0; i < 3; i++ {
-		if i == 1 {
-			s = strings.ToLower(s)
-		}
-		if i == 2 {
-			s = strings.ToUpper(s)
-		}
-		if ip := c.Request().Header().Get(s); ip != "" {
-			return net.ParseIP(ip)
-		}
-	}
-
-	s = "X-Forwarded-For"
-	for i = 0; i < 3; i++ {
-		if i == 1 {
-			s = strings.ToLower(s)
-		}
-		if i == 2 {
-			s = strings.ToUpper(s)
-		}
-		if ip := c.Request().Header().Get(s); ip != "" {
-			return net.ParseIP(strings.Split(ip, ", ")[0])
-		}
-	}
-
-	addr := c.Request().RemoteAddr
-	addr, _, _ = net.SplitHostPort(addr)
-	return net.ParseIP(addr)
+// Scheme returns the scheme used by the client, either http or https.
+// Forwarding headers are only used when the request comes from a
+// trusted proxy.
+func (c *Context) Scheme() string {
+	return c.request.origin().scheme
+}
 
+// Host returns the host requested by the client. Forwarding headers
+// are only used when the request comes from a trusted proxy.
+func (c *Context) Host() string {
+	return c.request.origin().host
 }
 
 // Redirect redirects the http request to a different url.
@@ -443,6 +550,37 @@ func (c *Context) Upgrade(protocols ...string) (err error) {
 
 }
 
+// host returns the host used to route the request, which is the
+// same host as Context.Host, so that it is taken from the headers
+// set by a trusted proxy.
+func (c *Context) host() string {
+	if c.request == nil || c.request.Request == nil {
+		return ""
+	}
+	return c.request.origin().host
+}
+
+// onFinish registers a function to be called once the request has
+// been handled, before the context is returned to the pool.
+func (c *Context) onFinish(fn func()) {
+	c.cleanup = append(c.cleanup, fn)
+}
+
+// finish calls the functions registered using onFinish in reverse,
+// and then removes any temporary files from a parsed multipart form.
+// The http server only removes the files of the original request, so
+// they would be left behind if the request had been replaced using
+// WithContext when the form was parsed.
+func (c *Context) finish() {
+	for i := len(c.cleanup) - 1; i >= 0; i-- {
+		c.cleanup[i]()
+	}
+	c.cleanup = c.cleanup[:0]
+	if c.request.Request != nil && c.request.MultipartForm != nil {
+		c.request.MultipartForm.RemoveAll()
+	}
+}
+
 func (c *Context) reset(r *http.Request, w http.ResponseWriter, f *Fibre) {
 
 	// Set the fibre instance
@@ -451,10 +589,14 @@ func (c *Context) reset(r *http.Request, w http.ResponseWriter, f *Fibre) {
 	// Set an id for this connection
 	c.uniq = ksuid.New().String()
 
-	// Reset the query and store vars
-	c.param = nil
+	// Reset the path, param, query and store vars
+	c.path = ""
+	c.allow = ""
+	c.pnames = c.pnames[:0]
+	c.pvalues = c.pvalues[:0]
 	c.query = nil
 	c.store = nil
+	c.gate = nil
 
 	// Reset the request and response
 	c.socket = nil
@@ -465,3 +607,40 @@ func (c *Context) reset(r *http.Request, w http.ResponseWriter, f *Fibre) {
 	c.query = r.URL.Query()
 
 }
+
+// detached is a context which keeps the values of its parent,
+// but which is never cancelled, and which has no deadline.
+type detached struct {
+	parent context.Context
+}
+
+func (d detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (d detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (d detached) Err() error {
+	return nil
+}
+
+func (d detached) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
+
+// discard is a response writer which discards the response.
+type discard struct {
+	header http.Header
+}
+
+func (d *discard) Header() http.Header {
+	return d.header
+}
+
+func (d *discard) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (d *discard) WriteHeader(code int) {}
@@ -0,0 +1,147 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFinishRemovesMultipartFiles(t *testing.T) {
+
+	dir := t.TempDir()
+
+	t.Setenv("TMPDIR", dir)
+
+	f := Server()
+
+	f.Post("/upload", func(c *Context) error {
+		type key struct{}
+		c.WithContext(context.WithValue(c.Context(), key{}, true))
+		if _, err := c.FormFile("file"); err != nil {
+			return err
+		}
+		if names, _ := ioutil.ReadDir(dir); len(names) == 0 {
+			t.Errorf("expected the form file to be stored on disk")
+		}
+		return c.Code(200)
+	})
+
+	body, mime := testMultipart(nil, map[string]string{"file": strings.Repeat("a", maxMemory+1)})
+	req := httptest.NewRequest(POST, "/upload", body)
+	req.Header.Set(HeaderContentType, mime)
+	res := httptest.NewRecorder()
+	f.ServeHTTP(res, req)
+
+	if res.Code != 200 {
+		t.Fatalf("expected status 200, got %d", res.Code)
+	}
+
+	if names, _ := ioutil.ReadDir(dir); len(names) != 0 {
+		t.Errorf("expected the form files to be removed, got %d", len(names))
+	}
+
+}
+
+func TestCloneDetachNotReused(t *testing.T) {
+
+	f := Server()
+
+	var wait sync.WaitGroup
+
+	finished := make(chan struct{})
+
+	check := func(c *Context, id string) {
+		defer wait.Done()
+		// Let the handler return, and the context be reused
+		time.Sleep(5 * time.Millisecond)
+		if v := c.Param("id"); v != id {
+			t.Errorf("expected param %q, got %q", id, v)
+		}
+		if v := c.Query("id"); v != id {
+			t.Errorf("expected query %q, got %q", id, v)
+		}
+		if v := c.Get("id"); v != id {
+			t.Errorf("expected value %q, got %v", id, v)
+		}
+		if v := c.Request().Header().Get("X-Id"); v != id {
+			t.Errorf("expected header %q, got %q", id, v)
+		}
+	}
+
+	f.Get("/items/:id", func(c *Context) error {
+
+		id := c.Param("id")
+
+		c.Set("id", id)
+
+		wait.Add(2)
+
+		go func(c *Context) {
+			check(c, id)
+			<-finished
+			if _, err := c.Response().Write([]byte("late")); err != errResponseClosed {
+				t.Errorf("expected a late write to the clone to fail, got %v", err)
+			}
+			c.Text(200, "late")
+		}(c.Clone())
+
+		go func(c *Context) {
+			check(c, id)
+			if err := c.Context().Err(); err != nil {
+				t.Errorf("expected the detached context not to be cancelled, got %v", err)
+			}
+			c.Text(200, "late")
+		}(c.Detach())
+
+		return c.Text(200, id)
+
+	})
+
+	var requests sync.WaitGroup
+
+	results := make([]*httptest.ResponseRecorder, 50)
+
+	for i := range results {
+		requests.Add(1)
+		results[i] = httptest.NewRecorder()
+		go func(id string, res *httptest.ResponseRecorder) {
+			defer requests.Done()
+			req := httptest.NewRequest(GET, "/items/"+id+"?id="+id, nil)
+			req.Header.Set("X-Id", id)
+			f.ServeHTTP(res, req)
+		}(strconv.Itoa(i), results[i])
+	}
+
+	requests.Wait()
+
+	close(finished)
+
+	wait.Wait()
+
+	// Late writes must not reach the finished responses
+	for i, res := range results {
+		if id := strconv.Itoa(i); res.Body.String() != id {
+			t.Errorf("expected %q, got %q", id, res.Body.String())
+		}
+	}
+
+}
@@ -15,6 +15,7 @@
 package fibre
 
 import (
+	"fmt"
 	"net/http"
 )
 
@@ -33,6 +34,28 @@ type HTTPError struct {
 	fields  map[string]interface{}
 }
 
+// RouteError represents an error that occurred while registering a route.
+type RouteError struct {
+	Route  *Route
+	Other  *Route
+	Reason string
+}
+
+// Error returns a message which describes both of the routes involved.
+func (e *RouteError) Error() string {
+	if e.Other == nil {
+		return fmt.Sprintf("fibre: route %s %s: %s", e.Route, describe(e.Route), e.Reason)
+	}
+	return fmt.Sprintf("fibre: route %s %s %s route %s %s", e.Route, describe(e.Route), e.Reason, e.Other, describe(e.Other))
+}
+
+func describe(r *Route) string {
+	if r.source == "" {
+		return "(" + funcName(r.Handler) + ")"
+	}
+	return "(" + funcName(r.Handler) + " registered at " + r.source + ")"
+}
+
 // NewHTTPError creates a new instance of HTTPError.
 func NewHTTPError(code int, message ...string) (err *HTTPError) {
 
@@ -15,6 +15,7 @@
 package fibre
 
 import (
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -25,13 +26,16 @@ type (
 	Fibre struct {
 		pool         sync.Pool
 		name         string
+		mime         string
 		wait         time.Duration
 		itimeout     time.Duration
 		rtimeout     time.Duration
 		wtimeout     time.Duration
 		logger       *Logger
 		router       *Router
-		middleware   Middleware
+		codecs       *Codecs
+		validators   map[string]ValidatorFunc
+		proxies      []*net.IPNet
 		errorHandler HTTPErrorHandler
 	}
 
@@ -80,6 +84,7 @@ const (
 	HeaderContentLength       = "Content-Length"
 	HeaderContentType         = "Content-Type"
 	HeaderCookie              = "Cookie"
+	HeaderForwarded           = "Forwarded"
 	HeaderIfModifiedSince     = "If-Modified-Since"
 	HeaderLastModified        = "Last-Modified"
 	HeaderLocation            = "Location"
@@ -89,6 +94,7 @@ const (
 	HeaderUpgrade             = "Upgrade"
 	HeaderVary                = "Vary"
 	HeaderXForwardedFor       = "X-Forwarded-For"
+	HeaderXForwardedHost      = "X-Forwarded-Host"
 	HeaderXForwardedProto     = "X-Forwarded-Proto"
 	HeaderXForwardedProtocol  = "X-Forwarded-Protocol"
 	HeaderXForwardedSsl       = "X-Forwarded-Ssl"
@@ -132,12 +138,18 @@ func Server() (f *Fibre) {
 	// Set the default name
 	f.name = "fibre"
 
+	// Set the default response type
+	f.mime = "application/json"
+
 	// Setup a new logger
 	f.logger = NewLogger(f)
 
 	// Setup a new router
 	f.router = NewRouter(f)
 
+	// Setup the default codecs
+	f.codecs = NewCodecs()
+
 	// Setup the default error handler
 	f.SetHTTPErrorHandler(f.defaultErrorHandler)
 
@@ -165,11 +177,28 @@ func (f *Fibre) Router() *Router {
 	return f.router
 }
 
+// Codecs returns the codec registry.
+func (f *Fibre) Codecs() *Codecs {
+	return f.codecs
+}
+
+// SetCodecOpts sets the options used by the json, cbor and msgpack
+// codecs for request and response bodies, sockets, and rpc calls.
+func (f *Fibre) SetCodecOpts(opts CodecOpts) error {
+	return f.codecs.Configure(opts)
+}
+
 // SetName sets the instance name.
 func (f *Fibre) SetName(name string) {
 	f.name = name
 }
 
+// SetDefaultType sets the response type used by Context.Send
+// when the request does not specify which type it accepts.
+func (f *Fibre) SetDefaultType(mime string) {
+	f.mime = mime
+}
+
 // SetLogLevel sets the logger log level.
 func (f *Fibre) SetLogLevel(l string) {
 	f.Logger().SetLevel(l)
@@ -200,76 +229,124 @@ func (f *Fibre) SetHTTPErrorHandler(h HTTPErrorHandler) {
 	f.errorHandler = h
 }
 
+// SetMethodNotAllowed sets whether to respond with 405 when a path
+// exists under another method. Disable this when relying on a catch
+// all (*) route registered for only some methods.
+func (f *Fibre) SetMethodNotAllowed(v bool) {
+	f.router.SetMethodNotAllowed(v)
+}
+
+// SetAutoOptions sets whether OPTIONS requests are answered using the
+// methods registered for the path, when no OPTIONS route exists.
+func (f *Fibre) SetAutoOptions(v bool) {
+	f.router.SetAutoOptions(v)
+}
+
+// SetTrailingSlash sets how a trailing slash difference between the
+// request path and a route is handled: "match", "redirect" or "strict".
+func (f *Fibre) SetTrailingSlash(v string) {
+	f.router.SetTrailingSlash(v)
+}
+
+// SetCleanPath sets whether requests with duplicate slashes or dot
+// segments in the path are redirected to the cleaned path.
+func (f *Fibre) SetCleanPath(v bool) {
+	f.router.SetCleanPath(v)
+}
+
+// SetCaseInsensitive sets whether routes are matched case-insensitively.
+func (f *Fibre) SetCaseInsensitive(v bool) {
+	f.router.SetCaseInsensitive(v)
+}
+
+// URL returns the path for a named route, replacing the route
+// parameters with the given name and value pairs, or an empty
+// string if the route does not exist or a parameter is missing.
+func (f *Fibre) URL(name string, pairs ...string) string {
+	u, _ := f.router.URL(name, pairs...)
+	return u
+}
+
 // Use adds a middleware function
 func (f *Fibre) Use(m MiddlewareFunc) MiddlewareFunc {
-	f.middleware = append(f.middleware, m)
+	f.router.use(m)
 	return m
 }
 
 // Head adds a HEAD route > handler to the router.
-func (f *Fibre) Head(p string, h HandlerFunc) {
-	f.router.Add(HEAD, p, h)
+func (f *Fibre) Head(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return f.add(HEAD, p, h, m...)
 }
 
 // Get adds a GET route > handler to the router.
-func (f *Fibre) Get(p string, h HandlerFunc) {
-	f.router.Add(GET, p, h)
+func (f *Fibre) Get(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return f.add(GET, p, h, m...)
 }
 
 // Put adds a PUT route > handler to the router.
-func (f *Fibre) Put(p string, h HandlerFunc) {
-	f.router.Add(PUT, p, h)
+func (f *Fibre) Put(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return f.add(PUT, p, h, m...)
 }
 
 // Post adds a POST route > handler to the router.
-func (f *Fibre) Post(p string, h HandlerFunc) {
-	f.router.Add(POST, p, h)
+func (f *Fibre) Post(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return f.add(POST, p, h, m...)
 }
 
 // Patch adds a PATCH route > handler to the router.
-func (f *Fibre) Patch(p string, h HandlerFunc) {
-	f.router.Add(PATCH, p, h)
+func (f *Fibre) Patch(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return f.add(PATCH, p, h, m...)
 }
 
 // Trace adds a TRACE route > handler to the router.
-func (f *Fibre) Trace(p string, h HandlerFunc) {
-	f.router.Add(TRACE, p, h)
+func (f *Fibre) Trace(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return f.add(TRACE, p, h, m...)
 }
 
 // Delete adds a DELETE route > handler to the router.
-func (f *Fibre) Delete(p string, h HandlerFunc) {
-	f.router.Add(DELETE, p, h)
+func (f *Fibre) Delete(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return f.add(DELETE, p, h, m...)
 }
 
 // Options adds an OPTIONS route > handler to the router.
-func (f *Fibre) Options(p string, h HandlerFunc) {
-	f.router.Add(OPTIONS, p, h)
+func (f *Fibre) Options(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return f.add(OPTIONS, p, h, m...)
 }
 
 // Connect adds a CONNECT route > handler to the router.
-func (f *Fibre) Connect(p string, h HandlerFunc) {
-	f.router.Add(CONNECT, p, h)
+func (f *Fibre) Connect(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return f.add(CONNECT, p, h, m...)
 }
 
 // Any adds a route > handler to the router for all HTTP methods.
-func (f *Fibre) Any(p string, h HandlerFunc) {
-	for _, m := range methods {
-		f.router.Add(m, p, h)
+func (f *Fibre) Any(p string, h HandlerFunc, m ...MiddlewareFunc) {
+	for _, meth := range methods {
+		f.add(meth, p, h, m...)
 	}
 }
 
 // Dir serves a folder.
-func (f *Fibre) Dir(p, dir string) {
-	f.Get(p+"*", func(c *Context) error {
+func (f *Fibre) Dir(p, dir string, m ...MiddlewareFunc) *Route {
+	return f.Get(p+"*", func(c *Context) error {
 		return c.File(dir + c.Param("*"))
-	})
+	}, m...)
 }
 
 // File serves a file.
-func (f *Fibre) File(p, file string) {
-	f.Get(p, func(c *Context) error {
+func (f *Fibre) File(p, file string, m ...MiddlewareFunc) *Route {
+	return f.Get(p, func(c *Context) error {
 		return c.File(file)
-	})
+	}, m...)
+}
+
+// add registers the route with the router, and panics with the
+// details of the conflicting registration if it can not be added.
+func (f *Fibre) add(meth, p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	route, err := f.router.Add(meth, p, h, m...)
+	if err != nil {
+		panic(err)
+	}
+	return route
 }
 
 // ServeHTTP implements `http.Handler` interface, which serves HTTP requests.
@@ -279,26 +356,16 @@ func (f *Fibre) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	c.reset(r, w, f)
 
-	p := f.router.Find(r.Method, r.URL.Path, c)
-
-	// Catch all errors before sending any output
-	h := func(c *Context) (err error) {
-		if err = p(c); err != nil {
-			c.Error(err)
-		}
-		return
-	}
-
-	// Chain middleware with handler in the end
-	for i := len(f.middleware) - 1; i >= 0; i-- {
-		h = f.middleware[i](h)
-	}
+	h := f.router.Find(r.Method, r.URL.Path, c)
 
 	// Execute middleware and request chain
 	if err := h(c); err != nil {
 		c.Error(err)
 	}
 
+	// Release anything still using the context
+	c.finish()
+
 	f.pool.Put(c)
 
 }
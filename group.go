@@ -0,0 +1,141 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+// Group represents a set of routes which share a path prefix
+// and middleware. The group middleware is added to the route
+// middleware of each route registered through the group.
+type Group struct {
+	fibre      *Fibre
+	host       string
+	prefix     string
+	middleware Middleware
+}
+
+// Group creates a new route group with a path prefix and middleware.
+func (f *Fibre) Group(p string, m ...MiddlewareFunc) *Group {
+	return &Group{
+		fibre:      f,
+		prefix:     p,
+		middleware: append(Middleware(nil), m...),
+	}
+}
+
+// Group creates a nested route group with a path prefix and middleware.
+func (g *Group) Group(p string, m ...MiddlewareFunc) *Group {
+	return &Group{
+		fibre:      g.fibre,
+		host:       g.host,
+		prefix:     g.prefix + p,
+		middleware: append(append(Middleware(nil), g.middleware...), m...),
+	}
+}
+
+// Use adds a middleware function to any routes subsequently added to the group.
+func (g *Group) Use(m MiddlewareFunc) MiddlewareFunc {
+	g.middleware = append(g.middleware, m)
+	return m
+}
+
+// Head adds a HEAD route > handler to the group.
+func (g *Group) Head(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return g.add(HEAD, p, h, m...)
+}
+
+// Get adds a GET route > handler to the group.
+func (g *Group) Get(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return g.add(GET, p, h, m...)
+}
+
+// Put adds a PUT route > handler to the group.
+func (g *Group) Put(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return g.add(PUT, p, h, m...)
+}
+
+// Post adds a POST route > handler to the group.
+func (g *Group) Post(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return g.add(POST, p, h, m...)
+}
+
+// Patch adds a PATCH route > handler to the group.
+func (g *Group) Patch(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return g.add(PATCH, p, h, m...)
+}
+
+// Trace adds a TRACE route > handler to the group.
+func (g *Group) Trace(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return g.add(TRACE, p, h, m...)
+}
+
+// Delete adds a DELETE route > handler to the group.
+func (g *Group) Delete(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return g.add(DELETE, p, h, m...)
+}
+
+// Options adds an OPTIONS route > handler to the group.
+func (g *Group) Options(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return g.add(OPTIONS, p, h, m...)
+}
+
+// Connect adds a CONNECT route > handler to the group.
+func (g *Group) Connect(p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	return g.add(CONNECT, p, h, m...)
+}
+
+// Any adds a route > handler to the group for all HTTP methods.
+func (g *Group) Any(p string, h HandlerFunc, m ...MiddlewareFunc) {
+	for _, meth := range methods {
+		g.add(meth, p, h, m...)
+	}
+}
+
+// Rpc adds a route > handler to the group for a jsonrpc endpoint.
+func (g *Group) Rpc(p string, i interface{}, m ...MiddlewareFunc) {
+	routeRpc(g.add, p, i, m...)
+}
+
+// Dir serves a folder.
+func (g *Group) Dir(p, dir string, m ...MiddlewareFunc) *Route {
+	return g.Get(p+"*", func(c *Context) error {
+		return c.File(dir + c.Param("*"))
+	}, m...)
+}
+
+// File serves a file.
+func (g *Group) File(p, file string, m ...MiddlewareFunc) *Route {
+	return g.Get(p, func(c *Context) error {
+		return c.File(file)
+	}, m...)
+}
+
+// Replace registers a route > handler with the group, replacing
+// any route already registered for the method and path.
+func (g *Group) Replace(meth, p string, h HandlerFunc, m ...MiddlewareFunc) (*Route, error) {
+	return g.fibre.router.add(g.host, meth, g.prefix+p, h, append(append(Middleware(nil), g.middleware...), m...), true)
+}
+
+// Remove unregisters the route for the method and path from the
+// group, returning false if no route was registered for them.
+func (g *Group) Remove(meth, p string) bool {
+	return g.fibre.router.remove(g.host, meth, g.prefix+p)
+}
+
+func (g *Group) add(meth, p string, h HandlerFunc, m ...MiddlewareFunc) *Route {
+	route, err := g.fibre.router.add(g.host, meth, g.prefix+p, h, append(append(Middleware(nil), g.middleware...), m...), false)
+	if err != nil {
+		panic(err)
+	}
+	return route
+}
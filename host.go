@@ -0,0 +1,199 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"fmt"
+	"strings"
+)
+
+// host stores the routing tree for a virtual host. The host
+// pattern is matched against the request host label by label,
+// and any `{name}` labels are captured as path parameters.
+type host struct {
+	pattern string
+	labels  []string
+	names   []string
+	tree    *node
+}
+
+// Host creates a new route group whose routes are only matched
+// when the request host matches the pattern. Each label in the
+// pattern can be a `{name}` label, which matches any value and
+// which can then be retrieved using Context.Param. Requests for
+// hosts which do not match any pattern use the default routes.
+func (f *Fibre) Host(pattern string, m ...MiddlewareFunc) *Group {
+	return &Group{
+		fibre:      f,
+		host:       pattern,
+		middleware: append(Middleware(nil), m...),
+	}
+}
+
+// host returns the index of the host for the host pattern of the
+// route, adding it to the table if it does not exist yet, or -1 if
+// the route has no host. Hosts without parameters are kept in front
+// of those with parameters so that they win. A pattern which would
+// match the same hosts as an existing pattern, differing only in
+// its parameter names, is reported as an error.
+func (t *table) host(route *Route) (int, error) {
+
+	if route.Host == "" {
+		return -1, nil
+	}
+
+	pattern, labels := hostPattern(route.Host)
+
+	h := &host{
+		pattern: pattern,
+		labels:  labels,
+		tree:    new(node),
+	}
+
+	for i, other := range t.hosts {
+		if other.pattern == pattern {
+			return i, nil
+		}
+		if other.overlaps(h) {
+			return -1, &RouteError{Route: route, Reason: fmt.Sprintf("host %q is ambiguous with host %q", route.Host, other.pattern)}
+		}
+	}
+
+	for _, label := range h.labels {
+		if isLabelParam(label) {
+			h.names = append(h.names, label[1:len(label)-1])
+		}
+	}
+
+	i := len(t.hosts)
+
+	if len(h.names) == 0 {
+		for i > 0 && len(t.hosts[i-1].names) > 0 {
+			i--
+		}
+	}
+
+	t.hosts = append(t.hosts, nil)
+	copy(t.hosts[i+1:], t.hosts[i:])
+	t.hosts[i] = h
+
+	return i, nil
+
+}
+
+// lookup returns the index of the host for the host pattern,
+// or -1 if no routes have been registered for the host pattern.
+func (t *table) lookup(name string) int {
+	pattern, _ := hostPattern(name)
+	for i, h := range t.hosts {
+		if h.pattern == pattern {
+			return i
+		}
+	}
+	return -1
+}
+
+// hostPattern returns the normalised host pattern and its labels.
+// Only the static labels are matched ignoring case, so parameter
+// names keep the case in which they were given.
+func hostPattern(name string) (string, []string) {
+	labels := strings.Split(hostname(name), ".")
+	for i, label := range labels {
+		if !isLabelParam(label) {
+			labels[i] = strings.ToLower(label)
+		}
+	}
+	return strings.Join(labels, "."), labels
+}
+
+// overlaps checks whether both host patterns have the same labels,
+// with parameter labels in the same places, whatever their names.
+func (h *host) overlaps(o *host) bool {
+	if len(h.labels) != len(o.labels) {
+		return false
+	}
+	for i := range h.labels {
+		if isLabelParam(h.labels[i]) != isLabelParam(o.labels[i]) {
+			return false
+		}
+		if !isLabelParam(h.labels[i]) && h.labels[i] != o.labels[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// vhost returns the routing tree for the request host, along
+// with the names and values of any captured host parameters.
+func (t *table) vhost(name string, vals []string) (*node, []string, []string) {
+
+	if len(t.hosts) > 0 {
+		name = hostname(name)
+		for _, h := range t.hosts {
+			if v, ok := h.match(name, vals); ok {
+				return h.tree, h.names, v
+			}
+		}
+	}
+
+	return t.tree, nil, vals
+
+}
+
+func (h *host) match(name string, vals []string) ([]string, bool) {
+
+	for i, label := range h.labels {
+
+		part := name
+
+		if j := strings.IndexByte(name, '.'); j >= 0 {
+			if i == len(h.labels)-1 {
+				return nil, false
+			}
+			part, name = name[:j], name[j+1:]
+		} else {
+			if i != len(h.labels)-1 {
+				return nil, false
+			}
+			name = ""
+		}
+
+		switch {
+		case isLabelParam(label):
+			if len(part) == 0 {
+				return nil, false
+			}
+			vals = append(vals, part)
+		case !strings.EqualFold(label, part):
+			return nil, false
+		}
+
+	}
+
+	return vals, true
+
+}
+
+// hostname removes any port and trailing dot from the host.
+func hostname(h string) string {
+	if i := strings.LastIndexByte(h, ':'); i > strings.LastIndexByte(h, ']') {
+		h = h[:i]
+	}
+	return strings.TrimSuffix(h, ".")
+}
+
+func isLabelParam(label string) bool {
+	return len(label) > 2 && label[0] == '{' && label[len(label)-1] == '}'
+}
@@ -0,0 +1,81 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"net/http"
+	"strings"
+
+	"net/url"
+)
+
+// Mount serves an http.Handler for all HTTP methods below the path
+// prefix. The prefix is stripped from the request path before the
+// handler is called, and the fibre middleware is run as normal. As
+// a Fibre instance is an http.Handler, another Fibre instance can
+// be mounted as a sub-application, with its own error handler and
+// logger, and its own middleware which runs after this middleware.
+func (f *Fibre) Mount(p string, h http.Handler, m ...MiddlewareFunc) {
+	routeMount(f.add, p, h, m...)
+}
+
+// Mount serves an http.Handler for all HTTP methods below the path
+// prefix. The group prefix and the path prefix are both stripped
+// from the request path before the handler is called.
+func (g *Group) Mount(p string, h http.Handler, m ...MiddlewareFunc) {
+	routeMount(g.add, p, h, m...)
+}
+
+func routeMount(add func(string, string, HandlerFunc, ...MiddlewareFunc) *Route, p string, h http.Handler, m ...MiddlewareFunc) {
+
+	p = strings.TrimSuffix(p, "/")
+
+	hand := func(c *Context) error {
+		h.ServeHTTP(c.Response(), stripPrefix(c.Request().Request, c.Param("*")))
+		return nil
+	}
+
+	for _, meth := range methods {
+		if p != "" {
+			add(meth, p, hand, m...)
+		}
+		add(meth, p+"/*", hand, m...)
+	}
+
+}
+
+// stripPrefix returns a shallow copy of the request, with the
+// url path set to the part of the path which was not matched.
+func stripPrefix(r *http.Request, rest string) *http.Request {
+
+	path := "/" + rest
+
+	pre := strings.TrimSuffix(r.URL.Path, path)
+
+	req := new(http.Request)
+	*req = *r
+	req.URL = new(url.URL)
+	*req.URL = *r.URL
+	req.URL.Path = path
+
+	if raw := strings.TrimPrefix(r.URL.RawPath, pre); raw != r.URL.RawPath {
+		req.URL.RawPath = raw
+	} else {
+		req.URL.RawPath = ""
+	}
+
+	return req
+
+}
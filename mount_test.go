@@ -0,0 +1,76 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"testing"
+
+	"net/http"
+	"net/http/httptest"
+)
+
+func TestMount(t *testing.T) {
+
+	f := Server()
+
+	raw := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("raw " + r.Method + " " + r.URL.Path + " " + r.URL.RawPath))
+	})
+
+	sub := Server()
+	sub.Get("/users/:id", func(c *Context) error {
+		return c.Text(200, "sub "+c.Param("id"))
+	})
+
+	f.Mount("/raw/", raw)
+	f.Mount("/sub", sub)
+	f.Group("/api").Group("/v1").Mount("/raw", raw)
+
+	tests := []struct {
+		meth string
+		path string
+		code int
+		body string
+	}{
+		{"GET", "/raw", 200, "raw GET / "},
+		{"GET", "/raw/", 200, "raw GET / "},
+		{"GET", "/raw/a/b", 200, "raw GET /a/b "},
+		{"POST", "/raw/a", 200, "raw POST /a "},
+		{"PUT", "/raw/a", 200, "raw PUT /a "},
+		{"DELETE", "/raw/a", 200, "raw DELETE /a "},
+		{"PATCH", "/raw/a", 200, "raw PATCH /a "},
+		{"GET", "/raw/a%2Fb", 200, "raw GET /a/b /a%2Fb"},
+		{"GET", "/rawer", 404, ""},
+		{"GET", "/sub/users/42", 200, "sub 42"},
+		{"GET", "/sub/users", 404, ""},
+		{"GET", "/api/v1/raw/x", 200, "raw GET /x "},
+		{"GET", "/api/v1/raw", 200, "raw GET / "},
+		{"GET", "/api/raw/x", 404, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.meth, test.path, nil)
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, req)
+		if res.Code != test.code {
+			t.Errorf("%s %s: expected code %d, got %d", test.meth, test.path, test.code, res.Code)
+			continue
+		}
+		if test.code == 200 && res.Body.String() != test.body {
+			t.Errorf("%s %s: expected body %q, got %q", test.meth, test.path, test.body, res.Body.String())
+		}
+	}
+
+}
@@ -51,11 +51,21 @@ func Quit(opts ...*QuitOpts) fibre.MiddlewareFunc {
 				return h(c)
 			}
 
+			req := c.Request().Reader()
+
 			ctx, cancel := context.WithTimeout(c.Context(), config.Timeout)
 
 			c = c.WithContext(ctx)
 
-			defer cancel()
+			defer func() {
+				cancel()
+				// Keep any form parsed by the handler
+				cur := c.Request().Reader()
+				req.Form = cur.Form
+				req.PostForm = cur.PostForm
+				req.MultipartForm = cur.MultipartForm
+				c.Request().SetReader(req)
+			}()
 
 			return h(c)
 
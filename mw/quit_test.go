@@ -0,0 +1,63 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mw
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"net/http/httptest"
+
+	"github.com/surrealdb/fibre"
+)
+
+func TestQuitKeepsForm(t *testing.T) {
+
+	f := fibre.Server()
+
+	var form string
+
+	f.Use(func(h fibre.HandlerFunc) fibre.HandlerFunc {
+		return func(c *fibre.Context) error {
+			err := h(c)
+			form = c.Request().Reader().Form.Get("name")
+			return err
+		}
+	})
+
+	f.Use(Quit(&QuitOpts{Timeout: time.Second}))
+
+	f.Post("/", func(c *fibre.Context) error {
+		if c.Context().Done() == nil {
+			t.Errorf("expected the request context to have a timeout")
+		}
+		return c.Text(200, c.Form("name"))
+	})
+
+	req := httptest.NewRequest(fibre.POST, "/", strings.NewReader("name=tobie"))
+	req.Header.Set(fibre.HeaderContentType, "application/x-www-form-urlencoded")
+	res := httptest.NewRecorder()
+	f.ServeHTTP(res, req)
+
+	if res.Body.String() != "tobie" {
+		t.Errorf("expected %q, got %q", "tobie", res.Body.String())
+	}
+
+	if form != "tobie" {
+		t.Errorf("expected the form to be kept once the timeout is removed, got %q", form)
+	}
+
+}
@@ -52,8 +52,8 @@ func Secure(opts ...*SecureOpts) fibre.MiddlewareFunc {
 				config = opts[0]
 			}
 
-			if config.RedirectHTTP && (!c.IsTLS() || c.Request().Header().Get(fibre.HeaderXForwardedProto) == "http") {
-				h := c.Request().Host
+			if config.RedirectHTTP && c.Scheme() != "https" {
+				h := c.Host()
 				u := c.Request().RequestURI
 				return c.Redirect(301, "https://"+h+u)
 			}
@@ -83,7 +83,7 @@ func Secure(opts ...*SecureOpts) fibre.MiddlewareFunc {
 				c.Response().Header().Set(fibre.HeaderPublicKeyPins, config.PublicKeyPins)
 			}
 
-			if (c.IsTLS() || c.Request().Header().Get(fibre.HeaderXForwardedProto) == "https") && config.HSTSMaxAge != 0 {
+			if c.Scheme() == "https" && config.HSTSMaxAge != 0 {
 				if config.HSTSIncludeSubdomains {
 					c.Response().Header().Set(fibre.HeaderStrictTransportSecurity, fmt.Sprintf("max-age=%d; includeSubdomains", config.HSTSMaxAge))
 				} else {
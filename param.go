@@ -0,0 +1,247 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"encoding/hex"
+)
+
+// UUID represents a parsed uuid path parameter.
+type UUID [16]byte
+
+// String returns the canonical string form of the uuid.
+func (u UUID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+// constraints stores the named path parameter constraints,
+// which can be used in a route as `:id<int>`. Any constraint
+// which is not named here is compiled as a regular expression.
+var constraints = map[string]func(string) bool{
+	"int":   isInt,
+	"uint":  isUint,
+	"float": isFloat,
+	"bool":  isBool,
+	"uuid":  isUUID,
+	"alpha": isAlpha,
+	"alnum": isAlnum,
+}
+
+// parameter parses the route parameter at the start of the
+// path, returning its name, its constraint if one has been
+// specified, and the length of the parameter in the path.
+func parameter(path string) (name, cons string, size int) {
+
+	i := 1
+
+	for i < len(path) && path[i] != '/' && path[i] != '<' {
+		i++
+	}
+
+	name = path[1:i]
+
+	if i == len(path) || path[i] != '<' {
+		return name, "", i
+	}
+
+	for j, d := i, 0; j < len(path); j++ {
+		switch path[j] {
+		case '<':
+			d++
+		case '>':
+			if d--; d == 0 {
+				return name, path[i+1 : j], j + 1
+			}
+		}
+	}
+
+	return name, path[i+1:], len(path)
+
+}
+
+// constraint returns the matcher for a parameter constraint.
+func constraint(cons string) (func(string) bool, error) {
+
+	if cons == "" {
+		return nil, nil
+	}
+
+	if fnc, ok := constraints[cons]; ok {
+		return fnc, nil
+	}
+
+	exp, err := regexp.Compile("^(?:" + cons + ")$")
+	if err != nil {
+		return nil, err
+	}
+
+	return exp.MatchString, nil
+
+}
+
+// ParamInt returns path parameter by name as an int.
+func (c *Context) ParamInt(name string) (int, error) {
+	v, err := strconv.Atoi(c.Param(name))
+	if err != nil {
+		return 0, paramError(name, "an integer")
+	}
+	return v, nil
+}
+
+// ParamInt64 returns path parameter by name as an int64.
+func (c *Context) ParamInt64(name string) (int64, error) {
+	v, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil {
+		return 0, paramError(name, "an integer")
+	}
+	return v, nil
+}
+
+// ParamUint returns path parameter by name as a uint64.
+func (c *Context) ParamUint(name string) (uint64, error) {
+	v, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		return 0, paramError(name, "an unsigned integer")
+	}
+	return v, nil
+}
+
+// ParamFloat returns path parameter by name as a float64.
+func (c *Context) ParamFloat(name string) (float64, error) {
+	v, err := strconv.ParseFloat(c.Param(name), 64)
+	if err != nil {
+		return 0, paramError(name, "a number")
+	}
+	return v, nil
+}
+
+// ParamBool returns path parameter by name as a bool.
+func (c *Context) ParamBool(name string) (bool, error) {
+	v, err := strconv.ParseBool(c.Param(name))
+	if err != nil {
+		return false, paramError(name, "a boolean")
+	}
+	return v, nil
+}
+
+// ParamUUID returns path parameter by name as a UUID.
+func (c *Context) ParamUUID(name string) (u UUID, err error) {
+	v := c.Param(name)
+	if !isUUID(v) {
+		return u, paramError(name, "a uuid")
+	}
+	hex.Decode(u[:], []byte(strings.Replace(v, "-", "", 4)))
+	return u, nil
+}
+
+func paramError(name, kind string) *HTTPError {
+	return NewHTTPError(400, fmt.Sprintf("Parameter '%s' must be %s", name, kind)).WithField("param", name)
+}
+
+func isInt(s string) bool {
+	if len(s) > 1 && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	return isUint(s)
+}
+
+func isUint(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isFloat(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+func isBool(s string) bool {
+	switch s {
+	case "1", "t", "T", "true", "TRUE", "True":
+		return true
+	case "0", "f", "F", "false", "FALSE", "False":
+		return true
+	}
+	return false
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isAlpha(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if (s[i] < 'a' || s[i] > 'z') && (s[i] < 'A' || s[i] > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if (s[i] < 'a' || s[i] > 'z') && (s[i] < 'A' || s[i] > 'Z') && (s[i] < '0' || s[i] > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,153 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"fmt"
+	"testing"
+
+	"net/http/httptest"
+)
+
+func TestParamConstraints(t *testing.T) {
+
+	f := Server()
+
+	route := func(kind string) func(c *Context) error {
+		return func(c *Context) error {
+			out := kind
+			for i, k := range c.pnames {
+				out += " " + k + "=" + c.pvalues[i]
+			}
+			return c.Text(200, out)
+		}
+	}
+
+	// Register the fallback first, so that the order of the
+	// constraints is decided by the tree and not by the order
+	// in which the routes were added.
+	f.Get("/items/:name", route("any"))
+	f.Get("/items/:id<int>", route("int"))
+	f.Get("/items/:id<uuid>", route("uuid"))
+	f.Get("/items/:code<[a-z]{2}-[0-9]+>", route("regex"))
+	f.Get("/items/:id<int>/tags/:tag<alpha>", route("tags"))
+	f.Get("/users/:id", route("get"))
+	f.Post("/users/:user", route("post"))
+
+	tests := []struct {
+		meth string
+		path string
+		code int
+		body string
+	}{
+		{"GET", "/items/42", 200, "int id=42"},
+		{"GET", "/items/-42", 200, "int id=-42"},
+		{"GET", "/items/4.2", 200, "any name=4.2"},
+		{"GET", "/items/123e4567-e89b-12d3-a456-426614174000", 200, "uuid id=123e4567-e89b-12d3-a456-426614174000"},
+		{"GET", "/items/123e4567-e89b-12d3-a456-42661417400", 200, "any name=123e4567-e89b-12d3-a456-42661417400"},
+		{"GET", "/items/ab-12", 200, "regex code=ab-12"},
+		{"GET", "/items/ab-12x", 200, "any name=ab-12x"},
+		{"GET", "/items/42/tags/red", 200, "tags id=42 tag=red"},
+		{"GET", "/items/42/tags/r3d", 404, ""},
+		{"GET", "/items/abc/tags/red", 404, ""},
+		// routes sharing a parameter with different names
+		{"GET", "/users/1", 200, "get id=1"},
+		{"POST", "/users/1", 200, "post user=1"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.meth, test.path, nil)
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, req)
+		if res.Code != test.code {
+			t.Errorf("%s %s: expected code %d, got %d", test.meth, test.path, test.code, res.Code)
+			continue
+		}
+		if test.code == 200 && res.Body.String() != test.body {
+			t.Errorf("%s %s: expected body %q, got %q", test.meth, test.path, test.body, res.Body.String())
+		}
+	}
+
+}
+
+func TestParamConversion(t *testing.T) {
+
+	uuid := "123E4567-e89b-12d3-a456-426614174000"
+
+	tests := []struct {
+		kind  string
+		value string
+		out   string
+		fail  string
+	}{
+		{kind: "int", value: "-42", out: "-42"},
+		{kind: "int", value: "4.2", fail: "Parameter 'v' must be an integer"},
+		{kind: "int64", value: "9223372036854775807", out: "9223372036854775807"},
+		{kind: "int64", value: "9223372036854775808", fail: "Parameter 'v' must be an integer"},
+		{kind: "uint", value: "42", out: "42"},
+		{kind: "uint", value: "-42", fail: "Parameter 'v' must be an unsigned integer"},
+		{kind: "float", value: "4.2", out: "4.2"},
+		{kind: "float", value: "four", fail: "Parameter 'v' must be a number"},
+		{kind: "bool", value: "true", out: "true"},
+		{kind: "bool", value: "yes", fail: "Parameter 'v' must be a boolean"},
+		{kind: "uuid", value: uuid, out: "123e4567-e89b-12d3-a456-426614174000"},
+		{kind: "uuid", value: uuid[1:], fail: "Parameter 'v' must be a uuid"},
+		{kind: "uuid", value: "123e4567e89b12d3a456426614174000", fail: "Parameter 'v' must be a uuid"},
+	}
+
+	for _, test := range tests {
+
+		c := &Context{pnames: []string{"v"}, pvalues: []string{test.value}}
+
+		var out interface{}
+		var err error
+
+		switch test.kind {
+		case "int":
+			out, err = c.ParamInt("v")
+		case "int64":
+			out, err = c.ParamInt64("v")
+		case "uint":
+			out, err = c.ParamUint("v")
+		case "float":
+			out, err = c.ParamFloat("v")
+		case "bool":
+			out, err = c.ParamBool("v")
+		case "uuid":
+			out, err = c.ParamUUID("v")
+		}
+
+		if test.fail == "" {
+			if err != nil || fmt.Sprint(out) != test.out {
+				t.Errorf("%s %q: expected %s, got %v %v", test.kind, test.value, test.out, out, err)
+			}
+			continue
+		}
+
+		e, ok := err.(*HTTPError)
+		if !ok {
+			t.Errorf("%s %q: expected an HTTPError, got %v", test.kind, test.value, err)
+			continue
+		}
+		if e.Code() != 400 || e.Error() != test.fail {
+			t.Errorf("%s %q: expected 400 %q, got %d %q", test.kind, test.value, test.fail, e.Code(), e.Error())
+		}
+		if e.Fields()["param"] != "v" {
+			t.Errorf("%s %q: expected param field %q, got %v", test.kind, test.value, "v", e.Fields())
+		}
+
+	}
+
+}
@@ -0,0 +1,100 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"path"
+	"strings"
+
+	"net/url"
+)
+
+var redirectClean = func(c *Context) error {
+	return redirectPath(c, cleanPath(c.Request().Request.URL.Path))
+}
+
+var redirectSlash = func(c *Context) error {
+	p := c.Request().Request.URL.Path
+	if strings.HasSuffix(p, "/") {
+		return redirectPath(c, p[:len(p)-1])
+	}
+	return redirectPath(c, p+"/")
+}
+
+// redirectPath redirects the request to a different path on
+// the same host, keeping the query string. A permanent redirect
+// is used, which must not change the method of the request.
+func redirectPath(c *Context, p string) error {
+
+	code := 308
+
+	if c.Request().Method == GET || c.Request().Method == HEAD {
+		code = 301
+	}
+
+	// Never redirect to a protocol relative url
+	if strings.HasPrefix(p, "//") {
+		p = "/" + strings.TrimLeft(p, "/")
+	}
+
+	u := &url.URL{Path: p, RawQuery: c.Request().Request.URL.RawQuery}
+
+	return c.Redirect(code, u.String())
+
+}
+
+// isClean checks whether the path is absolute and does not
+// contain any duplicate slashes or any dot segments.
+func isClean(p string) bool {
+
+	if len(p) == 0 || p[0] != '/' {
+		return false
+	}
+
+	for i := 1; i < len(p); i++ {
+		if p[i-1] != '/' {
+			continue
+		}
+		switch {
+		case p[i] == '/':
+			return false
+		case p[i] == '.' && (i+1 == len(p) || p[i+1] == '/'):
+			return false
+		case p[i] == '.' && p[i+1] == '.' && (i+2 == len(p) || p[i+2] == '/'):
+			return false
+		}
+	}
+
+	return true
+
+}
+
+// cleanPath returns the canonical form of the path, keeping
+// any trailing slash which was present in the original path.
+func cleanPath(p string) string {
+
+	if p == "" {
+		return "/"
+	}
+
+	c := path.Clean("/" + p)
+
+	if p[len(p)-1] == '/' && c != "/" {
+		c += "/"
+	}
+
+	return c
+
+}
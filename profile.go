@@ -15,9 +15,39 @@
 package fibre
 
 import (
+	"fmt"
+	"strings"
+
 	"net/http/pprof"
+	"text/tabwriter"
 )
 
+// DebugRoutes adds a route which lists the registered routes. The
+// listing is sent as JSON if requested using the Accept header or
+// the `format=json` query parameter, and as a text table otherwise.
+func (f *Fibre) DebugRoutes() {
+	f.Get("/debug/routes", func(c *Context) error {
+
+		routes := f.router.Routes()
+
+		if c.Query("format") == "json" || strings.Contains(c.Request().Header().Get(HeaderAccept), "application/json") {
+			return c.JSON(200, routes)
+		}
+
+		c.Response().Header().Set(HeaderContentType, "text/plain; charset=utf-8")
+		c.Response().WriteHeader(200)
+
+		w := tabwriter.NewWriter(c.Response(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "METHOD\tHOST\tPATH\tNAME\tRANK\tMIDDLEWARE\tHANDLER")
+		for _, r := range routes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n", r.Method, r.Host, r.Path, r.Name, r.Rank, r.Middleware, r.Handler)
+		}
+
+		return w.Flush()
+
+	})
+}
+
 func (f *Fibre) Pprof() {
 	f.Get("/debug/pprof/", func(c *Context) error {
 		pprof.Index(c.Response().ResponseWriter, c.Request().Request)
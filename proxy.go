@@ -0,0 +1,235 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// origin describes where a request came from, either after taking
+// into account any headers set by trusted proxies, or as described
+// by a single proxy hop in a forwarding header.
+type origin struct {
+	ip     net.IP
+	scheme string
+	host   string
+}
+
+// SetTrustedProxies sets the addresses of the proxies whose
+// forwarding headers are trusted, as CIDR ranges or single ip
+// addresses. Forwarding headers are ignored for requests which
+// do not come directly from a trusted proxy.
+func (f *Fibre) SetTrustedProxies(cidrs ...string) error {
+
+	var nets []*net.IPNet
+
+	for _, cidr := range cidrs {
+
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", cidr)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q", cidr)
+		}
+
+		nets = append(nets, n)
+
+	}
+
+	f.proxies = nets
+
+	return nil
+
+}
+
+func (f *Fibre) trusted(ip net.IP) bool {
+	for _, n := range f.proxies {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// origin returns the client ip, scheme and host of the request. If
+// the request comes from a trusted proxy, the Forwarded header, or
+// otherwise the X-Forwarded-For header, is walked from right to left,
+// skipping any trusted proxies, and the first untrusted address is
+// used as the client ip. The scheme and host are taken from the same
+// Forwarded element, or from the X-Forwarded-Proto and
+// X-Forwarded-Host headers set by the nearest proxy.
+func (r *Request) origin() origin {
+
+	o := origin{host: r.Request.Host, scheme: "http"}
+
+	if r.TLS != nil {
+		o.scheme = "https"
+	}
+
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+
+	o.ip = net.ParseIP(addr)
+
+	if r.fibre == nil || !r.fibre.trusted(o.ip) {
+		return o
+	}
+
+	hops := forwarded(r.Header()[HeaderForwarded])
+
+	if len(hops) == 0 {
+		hops = xforwarded(r)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if hops[i].scheme != "" {
+			o.scheme = hops[i].scheme
+		}
+		if hops[i].host != "" {
+			o.host = hops[i].host
+		}
+		if hops[i].ip == nil {
+			break
+		}
+		o.ip = hops[i].ip
+		if !r.fibre.trusted(hops[i].ip) {
+			break
+		}
+	}
+
+	return o
+
+}
+
+// forwarded parses the elements of RFC 7239 Forwarded headers.
+func forwarded(heads []string) (hops []origin) {
+
+	for _, head := range heads {
+		for _, elem := range split(head, ',') {
+			var h origin
+			for _, pair := range split(elem, ';') {
+				i := strings.IndexByte(pair, '=')
+				if i < 0 {
+					continue
+				}
+				k := strings.ToLower(strings.TrimSpace(pair[:i]))
+				v := strings.Trim(strings.TrimSpace(pair[i+1:]), `"`)
+				switch k {
+				case "for":
+					h.ip = parseIP(v)
+				case "proto":
+					h.scheme = strings.ToLower(v)
+				case "host":
+					h.host = v
+				}
+			}
+			hops = append(hops, h)
+		}
+	}
+
+	return
+
+}
+
+// xforwarded parses the X-Forwarded-For header, and then uses the
+// last X-Forwarded-Proto and X-Forwarded-Host values, which were set
+// by the nearest proxy, for the scheme and host of the last hop.
+func xforwarded(r *Request) (hops []origin) {
+
+	for _, head := range r.Header()[HeaderXForwardedFor] {
+		for _, v := range strings.Split(head, ",") {
+			hops = append(hops, origin{ip: parseIP(strings.TrimSpace(v))})
+		}
+	}
+
+	if len(hops) == 0 {
+		if v := r.Header().Get(HeaderXRealIP); v != "" {
+			hops = append(hops, origin{ip: parseIP(strings.TrimSpace(v))})
+		}
+	}
+
+	if len(hops) == 0 {
+		hops = append(hops, origin{})
+	}
+
+	last := &hops[len(hops)-1]
+
+	switch {
+	case r.Header().Get(HeaderXForwardedProto) != "":
+		last.scheme = lastValue(r.Header().Get(HeaderXForwardedProto))
+	case r.Header().Get(HeaderXForwardedProtocol) != "":
+		last.scheme = lastValue(r.Header().Get(HeaderXForwardedProtocol))
+	case r.Header().Get(HeaderXUrlScheme) != "":
+		last.scheme = lastValue(r.Header().Get(HeaderXUrlScheme))
+	case strings.EqualFold(r.Header().Get(HeaderXForwardedSsl), "on"):
+		last.scheme = "https"
+	}
+
+	if v := r.Header().Get(HeaderXForwardedHost); v != "" {
+		last.host = lastValue(v)
+	}
+
+	return
+
+}
+
+// parseIP parses a node from a forwarding header, which may be
+// quoted, have a port, or have brackets around an ipv6 address.
+func parseIP(v string) net.IP {
+	if h, _, err := net.SplitHostPort(v); err == nil {
+		v = h
+	}
+	return net.ParseIP(strings.Trim(v, "[]"))
+}
+
+func lastValue(v string) string {
+	if i := strings.LastIndexByte(v, ','); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
+
+// split splits the string on the separator, ignoring any
+// separators which are inside double quoted strings.
+func split(s string, sep byte) (parts []string) {
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,288 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestOrigin(t *testing.T) {
+
+	f := Server()
+
+	if err := f.SetTrustedProxies("10.0.0.0/8", "fd00::1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		head   map[string]string
+		ip     string
+		scheme string
+		host   string
+	}{
+		{
+			name:   "no proxy",
+			remote: "1.2.3.4:1234",
+			ip:     "1.2.3.4",
+		},
+		{
+			name:   "untrusted remote",
+			remote: "6.6.6.6:1234",
+			head:   map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "https", "Forwarded": "for=1.2.3.4"},
+			ip:     "6.6.6.6",
+		},
+		{
+			name:   "unparseable remote",
+			remote: "@",
+			head:   map[string]string{"X-Forwarded-For": "1.2.3.4"},
+			ip:     "<nil>",
+		},
+		{
+			name:   "single hop",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"X-Forwarded-For": "1.2.3.4"},
+			ip:     "1.2.3.4",
+		},
+		{
+			name:   "spoofed leftmost entry",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4"},
+			ip:     "1.2.3.4",
+		},
+		{
+			name:   "trusted hops",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4, 10.0.0.2,10.0.0.3"},
+			ip:     "1.2.3.4",
+		},
+		{
+			name:   "only trusted hops",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			ip:     "10.0.0.3",
+		},
+		{
+			name:   "unparseable hop",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"X-Forwarded-For": "1.2.3.4, unknown, 10.0.0.2"},
+			ip:     "10.0.0.2",
+		},
+		{
+			name:   "forwarded proto and host",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "http, HTTPS", "X-Forwarded-Host": "Example.com"},
+			ip:     "1.2.3.4",
+			scheme: "https",
+			host:   "example.com",
+		},
+		{
+			name:   "forwarded ssl",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"X-Forwarded-Ssl": "on"},
+			ip:     "10.0.0.1",
+			scheme: "https",
+		},
+		{
+			name:   "real ip",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"X-Real-IP": "1.2.3.4"},
+			ip:     "1.2.3.4",
+		},
+		{
+			name:   "ipv6 remote",
+			remote: "[fd00::1]:1234",
+			head:   map[string]string{"X-Forwarded-For": "2001:db8::1"},
+			ip:     "2001:db8::1",
+		},
+		{
+			name:   "rfc 7239",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"Forwarded": "for=1.2.3.4;proto=https;host=example.com"},
+			ip:     "1.2.3.4",
+			scheme: "https",
+			host:   "example.com",
+		},
+		{
+			name:   "rfc 7239 preferred",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"Forwarded": "for=1.2.3.4", "X-Forwarded-For": "5.6.7.8"},
+			ip:     "1.2.3.4",
+		},
+		{
+			name:   "rfc 7239 spoofed leftmost entry",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"Forwarded": "for=6.6.6.6;host=evil.com, for=1.2.3.4;proto=https, for=10.0.0.2"},
+			ip:     "1.2.3.4",
+			scheme: "https",
+		},
+		{
+			name:   "rfc 7239 quoted ipv6",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"Forwarded": `for="[2001:db8::1]:4711";host="example.com:8080"`},
+			ip:     "2001:db8::1",
+			host:   "example.com:8080",
+		},
+		{
+			name:   "rfc 7239 quoted separators",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"Forwarded": `for="_a,b;c", for=1.2.3.4`},
+			ip:     "1.2.3.4",
+		},
+		{
+			name:   "rfc 7239 hidden hop",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"Forwarded": "for=1.2.3.4, for=_hidden, for=10.0.0.2"},
+			ip:     "10.0.0.2",
+		},
+		{
+			name:   "rfc 7239 unknown hop",
+			remote: "10.0.0.1:1234",
+			head:   map[string]string{"Forwarded": "for=unknown"},
+			ip:     "10.0.0.1",
+		},
+	}
+
+	for _, test := range tests {
+
+		req := httptest.NewRequest(GET, "http://localhost/", nil)
+		req.RemoteAddr = test.remote
+		for k, v := range test.head {
+			req.Header.Set(k, v)
+		}
+
+		o := NewRequest(req, f).origin()
+
+		if test.scheme == "" {
+			test.scheme = "http"
+		}
+
+		if test.host == "" {
+			test.host = "localhost"
+		}
+
+		if o.ip.String() != test.ip {
+			t.Errorf("%s: expected ip %s, got %s", test.name, test.ip, o.ip)
+		}
+
+		if o.scheme != test.scheme {
+			t.Errorf("%s: expected scheme %q, got %q", test.name, test.scheme, o.scheme)
+		}
+
+		if o.host != test.host {
+			t.Errorf("%s: expected host %q, got %q", test.name, test.host, o.host)
+		}
+
+	}
+
+}
+
+func TestRequestOriginRouting(t *testing.T) {
+
+	f := Server()
+
+	if err := f.SetTrustedProxies("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+
+	api := f.Host("api.example.com")
+
+	api.Get("/", func(c *Context) error {
+		return c.Text(200, "api "+c.Host())
+	})
+
+	api.Post("/items", func(c *Context) error {
+		return c.Code(201)
+	})
+
+	f.Get("/", func(c *Context) error {
+		return c.Text(200, "default "+c.Host())
+	})
+
+	tests := []struct {
+		name   string
+		meth   string
+		path   string
+		remote string
+		head   map[string]string
+		code   int
+		body   string
+		allow  string
+	}{
+		{
+			name: "direct", meth: GET, path: "/", remote: "1.2.3.4:1234",
+			code: 200, body: "default internal",
+		},
+		{
+			name: "forwarded host", meth: GET, path: "/", remote: "10.0.0.1:1234",
+			head: map[string]string{"X-Forwarded-Host": "api.example.com"},
+			code: 200, body: "api api.example.com",
+		},
+		{
+			name: "forwarded element", meth: GET, path: "/", remote: "10.0.0.1:1234",
+			head: map[string]string{"Forwarded": "for=1.2.3.4;host=api.example.com"},
+			code: 200, body: "api api.example.com",
+		},
+		{
+			name: "untrusted remote", meth: GET, path: "/", remote: "6.6.6.6:1234",
+			head: map[string]string{"X-Forwarded-Host": "api.example.com"},
+			code: 200, body: "default internal",
+		},
+		{
+			name: "forwarded allow", meth: DELETE, path: "/items", remote: "10.0.0.1:1234",
+			head: map[string]string{"X-Forwarded-Host": "api.example.com"},
+			code: 405, allow: "POST, OPTIONS",
+		},
+		{
+			name: "forwarded options", meth: OPTIONS, path: "/items", remote: "10.0.0.1:1234",
+			head: map[string]string{"X-Forwarded-Host": "api.example.com"},
+			code: 204, allow: "POST, OPTIONS",
+		},
+		{
+			name: "untrusted allow", meth: DELETE, path: "/items", remote: "6.6.6.6:1234",
+			head: map[string]string{"X-Forwarded-Host": "api.example.com"},
+			code: 404,
+		},
+	}
+
+	for _, test := range tests {
+
+		req := httptest.NewRequest(test.meth, "http://internal"+test.path, nil)
+		req.RemoteAddr = test.remote
+		for k, v := range test.head {
+			req.Header.Set(k, v)
+		}
+
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, req)
+
+		if res.Code != test.code {
+			t.Errorf("%s: expected code %d, got %d", test.name, test.code, res.Code)
+			continue
+		}
+
+		if test.body != "" && res.Body.String() != test.body {
+			t.Errorf("%s: expected body %q, got %q", test.name, test.body, res.Body.String())
+		}
+
+		if v := res.Header().Get(HeaderAllow); v != test.allow {
+			t.Errorf("%s: expected Allow header %q, got %q", test.name, test.allow, v)
+		}
+
+	}
+
+}
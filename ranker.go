@@ -1,27 +0,0 @@
-// Copyright © SurrealDB Ltd
-//
-// Licensed under the Apache License, Version 2.0 (the "License");
-// you may not use this file except in compliance with the License.
-// You may obtain a copy of the License at
-//
-//     http://www.apache.org/licenses/LICENSE-2.0
-//
-// Unless required by applicable law or agreed to in writing, software
-// distributed under the License is distributed on an "AS IS" BASIS,
-// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-// See the License for the specific language governing permissions and
-// limitations under the License.
-
-package fibre
-
-type ranker []*Route
-
-func (s ranker) Len() int {
-	return len(s)
-}
-func (s ranker) Swap(i, j int) {
-	s[i], s[j] = s[j], s[i]
-}
-func (s ranker) Less(i, j int) bool {
-	return s[i].Rank < s[j].Rank
-}
@@ -38,7 +38,8 @@ func (r *Request) Size() int64 {
 
 // URL returns the parsed url of the request.
 func (r *Request) URL() *URL {
-	return NewURL(r.TLS != nil, r.Host+r.RequestURI)
+	o := r.origin()
+	return newURL(o.scheme, o.host, r.Request.URL)
 }
 
 // Start returns the current size, in bytes, of the request.
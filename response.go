@@ -16,10 +16,17 @@ package fibre
 
 import (
 	"bufio"
+	"errors"
 	"net"
 	"net/http"
+	"strconv"
+	"sync"
 )
 
+// errResponseClosed is returned when writing to the response of a
+// cloned context once the request of the original has finished.
+var errResponseClosed = errors.New("fibre: response is closed")
+
 // Response wraps an http.Response
 type Response struct {
 	http.ResponseWriter
@@ -99,6 +106,135 @@ func (r *Response) CloseNotify() <-chan bool {
 	return r.ResponseWriter.(http.CloseNotifier).CloseNotify()
 }
 
+// headWriter wraps an http.ResponseWriter, discarding the body
+// of the response, so that a GET handler can serve HEAD requests.
+// The status code is held back until the handler has finished, so
+// that the Content-Length of the discarded body can be set.
+type headWriter struct {
+	http.ResponseWriter
+	code int
+	size int64
+}
+
+// headChain runs the handler with the response body discarded.
+func headChain(h HandlerFunc) HandlerFunc {
+	return func(c *Context) (err error) {
+		w := &headWriter{ResponseWriter: c.response.ResponseWriter}
+		c.response.ResponseWriter = w
+		defer func() {
+			c.response.ResponseWriter = w.ResponseWriter
+			w.finish()
+		}()
+		return h(c)
+	}
+}
+
+func (w *headWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *headWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.size += int64(len(b))
+	return len(b), nil
+}
+
+func (w *headWriter) Flush() {}
+
+func (w *headWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (w *headWriter) CloseNotify() <-chan bool {
+	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+func (w *headWriter) finish() {
+	if w.code == 0 {
+		return
+	}
+	if w.size > 0 && w.Header().Get(HeaderContentLength) == "" {
+		w.Header().Set(HeaderContentLength, strconv.FormatInt(w.size, 10))
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+// gate is shared by a context and its clones, and is closed once
+// the request of the context has finished.
+type gate struct {
+	mutex  sync.Mutex
+	closed bool
+}
+
+func (g *gate) close() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.closed = true
+}
+
+// clonedWriter wraps the http.ResponseWriter of a cloned context,
+// passing writes through to the response until the gate is closed,
+// after which the response can no longer be written to.
+type clonedWriter struct {
+	http.ResponseWriter
+	gate   *gate
+	header http.Header
+}
+
+func (w *clonedWriter) Header() http.Header {
+	w.gate.mutex.Lock()
+	defer w.gate.mutex.Unlock()
+	if w.gate.closed {
+		if w.header == nil {
+			w.header = make(http.Header)
+		}
+		return w.header
+	}
+	return w.ResponseWriter.Header()
+}
+
+func (w *clonedWriter) WriteHeader(code int) {
+	w.gate.mutex.Lock()
+	defer w.gate.mutex.Unlock()
+	if !w.gate.closed {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *clonedWriter) Write(b []byte) (int, error) {
+	w.gate.mutex.Lock()
+	defer w.gate.mutex.Unlock()
+	if w.gate.closed {
+		return 0, errResponseClosed
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *clonedWriter) Flush() {
+	w.gate.mutex.Lock()
+	defer w.gate.mutex.Unlock()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.gate.closed {
+		f.Flush()
+	}
+}
+
+func (w *clonedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.gate.mutex.Lock()
+	defer w.gate.mutex.Unlock()
+	if w.gate.closed {
+		return nil, nil, errResponseClosed
+	}
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (w *clonedWriter) CloseNotify() <-chan bool {
+	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
 func (r *Response) reset(i http.ResponseWriter, f *Fibre) {
 	r.fibre = f
 	r.ResponseWriter = i
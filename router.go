@@ -15,193 +15,651 @@
 package fibre
 
 import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+
 	"net/url"
-	"sort"
+	"sync/atomic"
 )
 
 // Router stores routes used in request matching and handler dispatching.
+// The routes are stored in an immutable table, which is replaced as a
+// whole whenever the routes change, so routes can be added, replaced,
+// or removed while requests are being served. Requests read the current
+// table without locking, and always see a consistent set of routes.
 type Router struct {
-	fibre  *Fibre
-	routes map[string][]*Route
+	fibre      *Fibre
+	mutex      sync.Mutex
+	value      atomic.Value
+	middleware Middleware
+	errors     []error
+	allow      bool
+	options    bool
+	clean      bool
+	nocase     bool
+	slash      string
 }
 
 // Route stores a handler for matching paths against requests.
 type Route struct {
-	Rank    int
-	Path    string
-	Method  string
-	Handler HandlerFunc
+	Rank       int
+	Name       string
+	Host       string
+	Path       string
+	Method     string
+	Handler    HandlerFunc
+	Middleware Middleware
+	names      []string
+	router     *Router
+	source     string
+}
+
+// RouteInfo describes a route registered with the router.
+type RouteInfo struct {
+	Host       string `json:"host,omitempty"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Name       string `json:"name,omitempty"`
+	Rank       int    `json:"rank"`
+	Middleware int    `json:"middleware"`
+	Handler    string `json:"handler"`
+}
+
+var notFound = func(c *Context) error {
+	return NewHTTPError(404)
+}
+
+var notAllowed = func(c *Context) error {
+	c.Response().Header().Set(HeaderAllow, c.allow)
+	return NewHTTPError(405)
+}
+
+var autoOptions = func(c *Context) error {
+	c.Response().Header().Set(HeaderAllow, c.allow)
+	return c.Code(204)
 }
 
 // NewRouter returns a new Router instance.
 func NewRouter(f *Fibre) *Router {
-	return &Router{
-		fibre:  f,
-		routes: make(map[string][]*Route),
+	r := &Router{
+		fibre:   f,
+		allow:   true,
+		options: true,
+		slash:   "match",
 	}
+	r.value.Store(r.rebuild(&table{tree: new(node), names: map[string]*Route{}}))
+	return r
+}
+
+// Add registers a new route with a matcher for the URL path. Any
+// route middleware is run after the global middleware, and the
+// full chain is compiled once when the route is registered. An
+// error is returned if the path is malformed, or if the route
+// conflicts with a route which has already been registered.
+func (r *Router) Add(meth, path string, hand HandlerFunc, m ...MiddlewareFunc) (*Route, error) {
+	return r.add("", meth, path, hand, m, false)
+}
+
+// Replace registers a new route with a matcher for the URL path,
+// replacing any route already registered for the method and path.
+// A replaced route keeps its name, so that Router.URL still works.
+func (r *Router) Replace(meth, path string, hand HandlerFunc, m ...MiddlewareFunc) (*Route, error) {
+	return r.add("", meth, path, hand, m, true)
 }
 
-// Add registers a new route with a matcher for the URL path.
-func (r *Router) Add(meth, path string, hand HandlerFunc) {
+// Remove unregisters the route for the method and path, returning
+// false if no route was registered for the method and path.
+func (r *Router) Remove(meth, path string) bool {
+	return r.remove("", meth, path)
+}
+
+func (r *Router) remove(host, meth, path string) bool {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	t := r.load()
+
+	i, tree := -1, t.tree
+
+	if host != "" {
+		if i = t.lookup(host); i < 0 {
+			return false
+		}
+		tree = t.hosts[i].tree
+	}
+
+	if n := tree.get(path); n == nil || n.routes[meth] == nil {
+		return false
+	}
+
+	t = t.copy()
+
+	root, leaf := tree.insert(path)
+
+	old := leaf.routes[meth].route
+
+	delete(leaf.routes, meth)
+
+	if i < 0 {
+		t.tree = root
+	} else {
+		c := *t.hosts[i]
+		c.tree = root
+		t.hosts[i] = &c
+	}
+
+	t.drop(old)
+
+	r.value.Store(t)
+
+	return true
+
+}
+
+func (r *Router) add(host, meth, path string, hand HandlerFunc, m Middleware, replace bool) (*Route, error) {
 
 	route := &Route{
-		Path:    path,
-		Method:  meth,
-		Handler: hand,
+		Host:       host,
+		Path:       path,
+		Method:     meth,
+		Handler:    hand,
+		Middleware: append(Middleware(nil), m...),
+		router:     r,
+		source:     caller(),
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Check the route path
+	if err := route.validate(); err != nil {
+		return nil, r.fail(err)
 	}
 
 	// Rank the route
 	route.Rank = route.rank()
 
-	// Add the route to the tree
-	r.routes[meth] = append(r.routes[meth], route)
+	// Store the parameter names
+	route.names = route.params()
+
+	// Add the route to a copy of the table
+	t := r.load().copy()
+
+	old, err := r.insert(t, route)
+	if err != nil {
+		return nil, r.fail(err)
+	}
+
+	if old != nil && !replace {
+		return nil, r.fail(&RouteError{Route: route, Other: old, Reason: "conflicts with"})
+	}
+
+	if old != nil {
+		t.drop(old)
+		if old.Name != "" {
+			route.Name = old.Name
+			t.names = t.copyNames()
+			t.names[route.Name] = route
+		}
+	}
+
+	t.routes = append(t.routes, route)
+
+	r.value.Store(t)
+
+	return route, nil
+
+}
+
+// Validate returns every error which has occurred while building
+// the routing table, including any routes which failed to be added,
+// ambiguous host patterns, and route names which have been reused.
+func (r *Router) Validate() []error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]error(nil), r.errors...)
+}
+
+func (r *Router) fail(err error) error {
+	r.errors = append(r.errors, err)
+	return err
+}
+
+// Routes returns a description of each registered route, in the
+// order in which the routes were registered. The middleware count
+// includes both the global middleware and the route middleware.
+func (r *Router) Routes() []RouteInfo {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	t := r.load()
+
+	out := make([]RouteInfo, 0, len(t.routes))
+
+	for _, route := range t.routes {
+		out = append(out, RouteInfo{
+			Host:       route.Host,
+			Method:     route.Method,
+			Path:       route.Path,
+			Name:       route.Name,
+			Rank:       route.Rank,
+			Middleware: len(r.middleware) + len(route.Middleware),
+			Handler:    funcName(route.Handler),
+		})
+	}
+
+	return out
+
+}
+
+// URL builds the path for the named route, replacing each route
+// parameter with the value following its name in the pairs.
+func (r *Router) URL(name string, pairs ...string) (string, error) {
 
-	// Sort the routes according to rank
-	sort.Sort(ranker(r.routes[meth]))
+	route, ok := r.load().names[name]
+	if !ok {
+		return "", fmt.Errorf("route %q is not registered", name)
+	}
 
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("route %q requires parameter name and value pairs", name)
+	}
+
+	return route.build(name, pairs)
+
+}
+
+// SetMethodNotAllowed specifies whether a request for a path
+// which is only registered under other methods should receive
+// a 405 response, instead of a 404 response.
+func (r *Router) SetMethodNotAllowed(v bool) {
+	r.allow = v
+}
+
+// SetAutoOptions specifies whether OPTIONS requests should be
+// answered automatically from the registered methods when no
+// explicit OPTIONS handler has been registered for the path.
+func (r *Router) SetAutoOptions(v bool) {
+	r.options = v
+}
+
+// SetTrailingSlash specifies how a request path which only differs
+// from a route by a trailing slash is handled. With "match" the
+// route is used, with "redirect" the request is redirected to the
+// path of the route, and with "strict" the route does not match.
+func (r *Router) SetTrailingSlash(v string) {
+	switch v {
+	case "match", "redirect", "strict":
+		r.slash = v
+	}
+}
+
+// SetCleanPath specifies whether a request path with duplicate
+// slashes or dot segments is redirected to the cleaned path.
+func (r *Router) SetCleanPath(v bool) {
+	r.clean = v
+}
+
+// SetCaseInsensitive specifies whether the static parts of a
+// route path are matched against the request case-insensitively.
+func (r *Router) SetCaseInsensitive(v bool) {
+	r.nocase = v
 }
 
 // Find dispatches the request to the handler whose path and method match
 func (r *Router) Find(meth, path string, ctx *Context) (hand HandlerFunc) {
 
-	routes := r.routes[meth]
+	t := r.load()
+
+	if r.clean && !isClean(path) {
+		return t.cleaner
+	}
+
+	tree, names, hvals := t.vhost(ctx.host(), ctx.pvalues[:0])
 
-	for _, route := range routes {
-		if pa, ok := route.test(path); ok {
-			ctx.param = pa
-			return route.Handler
+	h, vals, slashed := r.lookup(tree, meth, path, hvals)
+
+	if h != nil {
+		hand = h.chain
+	}
+
+	// Serve HEAD requests using any GET route
+	if h == nil && meth == HEAD {
+		if h, vals, slashed = r.lookup(tree, GET, path, hvals); h != nil {
+			hand = h.head
 		}
 	}
 
-	// NOTE: This is slow, and also pointless if there is a catch all (*) route
+	if h != nil && slashed && r.slash == "redirect" {
+		return t.slasher
+	}
 
-	// allowed := make([]string, 0, len(r.routes))
-	// for mech, routes := range r.routes {
-	// 	if mech == meth {
-	// 		continue
-	// 	}
-	// 	for _, route := range routes {
-	// 		if _, ok := route.test(path); ok {
-	// 			allowed = append(allowed, mech)
-	// 		}
-	// 	}
-	// }
+	if h == nil {
 
-	// if len(allowed) >= 1 {
-	// 	return func(c *Context) error {
-	// 		return NewHTTPError(405)
-	// 	}
-	// }
+		// The allowed methods are found in the same table
+		// which the request was matched against, so that a
+		// concurrent route change cannot alter the result.
+		if meth == OPTIONS && r.options && r.exists(tree, path, hvals) {
+			ctx.allow = r.allowed(tree, path, hvals)
+			return t.replies
+		}
+
+		if r.allow && r.exists(tree, path, hvals) {
+			ctx.allow = r.allowed(tree, path, hvals)
+			return t.invalid
+		}
+
+		return t.missing
 
-	return func(c *Context) error {
-		return NewHTTPError(404)
 	}
 
+	ctx.path = h.route.Path
+	ctx.pnames = append(append(ctx.pnames[:0], names...), h.route.names...)
+	ctx.pvalues = vals
+
+	return hand
+
 }
 
-func (r *Route) rank() (rank int) {
+// use adds a global middleware function, and then rebuilds the
+// table so that the middleware chain of every route includes it.
+func (r *Router) use(m MiddlewareFunc) {
 
-	for _, c := range r.Path {
-		switch c {
-		default:
-			rank++
-		case ':':
-			rank += 100
-		case '*':
-			rank += 10000
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.middleware = append(r.middleware, m)
+
+	r.value.Store(r.rebuild(r.load()))
+
+}
+
+// chain wraps the handler with the route middleware and then
+// with the global middleware, so that it can be run directly.
+func (r *Router) chain(p HandlerFunc, m Middleware) HandlerFunc {
+
+	// Catch all errors before sending any output
+	h := func(c *Context) (err error) {
+		if err = p(c); err != nil {
+			c.Error(err)
 		}
+		return
 	}
 
-	if rank > 20000 {
-		panic("Path must only have 1 match all (*)")
+	// Chain route middleware with handler in the end
+	for i := len(m) - 1; i >= 0; i-- {
+		h = m[i](h)
 	}
 
-	if rank > 10000 && r.Path[len(r.Path)-1] != '*' {
-		panic("Match all (*) must be at end of path")
+	// Chain global middleware with route middleware
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](h)
 	}
 
-	return
+	return h
 
 }
 
-func (r *Route) test(path string) (url.Values, bool) {
+// lookup finds the route for the method and path in the tree.
+// Unless trailing slashes are strict, a path which only differs
+// from a route by a trailing slash is also matched, in which case
+// the returned bool is true so that the request can be redirected.
+func (r *Router) lookup(tree *node, meth, path string, vals []string) (*handle, []string, bool) {
 
-	var i int
-	var j int
-	var k string
-	var v string
+	if h, v := tree.find(meth, path, vals, r.nocase, false); h != nil {
+		return h, v, false
+	}
 
-	param := make(url.Values)
+	if r.slash == "strict" || len(path) == 0 || path == "/" {
+		return nil, nil, false
+	}
 
-	for i < len(r.Path) {
+	if path[len(path)-1] == '/' {
+		h, v := tree.find(meth, path[:len(path)-1], vals, r.nocase, false)
+		return h, v, h != nil
+	}
 
-		switch {
+	h, v := tree.find(meth, path, vals, r.nocase, true)
 
-		case r.Path[i] == '*':
-			i++
-			v, j = consumeCatch(j, path)
-			param.Add("*", v)
+	return h, v, h != nil
 
-		case r.Path[i] == ':':
-			i++
-			if k, i = consumeIdent(i, r.Path); len(k) == 0 {
-				return nil, false
-			}
-			if v, j = consumeIdent(j, path); len(v) == 0 {
-				return nil, false
-			}
-			param.Add(k, v)
+}
 
-		default:
-			k, i = consumeChars(i, r.Path)
-			v, j = consumeCount(j, path, len(k))
-			if k != v {
-				return nil, false
-			}
+func (r *Router) exists(tree *node, path string, vals []string) bool {
 
+	for _, meth := range methods {
+		if h, _, _ := r.lookup(tree, meth, path, vals); h != nil {
+			return true
 		}
+	}
+
+	return false
+
+}
+
+// allowed returns the value of the Allow header for the path,
+// listing each method which has a route for the path in the tree.
+func (r *Router) allowed(tree *node, path string, vals []string) string {
+
+	var allow []string
 
+	for _, meth := range methods {
+		if h, _, _ := r.lookup(tree, meth, path, vals); h != nil {
+			allow = append(allow, meth)
+		} else if h, _, _ := r.lookup(tree, GET, path, vals); meth == HEAD && h != nil {
+			allow = append(allow, meth)
+		} else if meth == OPTIONS && r.options {
+			allow = append(allow, meth)
+		}
 	}
 
-	if hasRemaining(j, path) {
-		return nil, false
+	return strings.Join(allow, ", ")
+
+}
+
+// SetName sets the name of the route, so that its path can be
+// generated with the parameter values using Router.URL.
+// If the name is already used by another route, the name is not
+// changed, and the conflict is reported by Router.Validate.
+func (r *Route) SetName(name string) *Route {
+
+	r.router.mutex.Lock()
+	defer r.router.mutex.Unlock()
+
+	t := r.router.load().copy()
+
+	if other, ok := t.names[name]; ok && other != r {
+		r.router.fail(&RouteError{Route: r, Other: other, Reason: fmt.Sprintf("reuses the name %q of", name)})
+		return r
+	}
+
+	t.names = t.copyNames()
+
+	if r.Name != "" {
+		delete(t.names, r.Name)
 	}
 
-	return param, true
+	r.Name = name
+
+	t.names[name] = r
+
+	r.router.value.Store(t)
+
+	return r
 
 }
 
-func hasRemaining(pos int, path string) bool {
-	return len(path) > pos+1
+// String returns the method, host, and path of the route.
+func (r *Route) String() string {
+	return r.Method + " " + r.Host + r.Path
 }
 
-func consumeCatch(pos int, path string) (s string, i int) {
-	return path[pos:], len(path)
+func (r *Route) build(name string, pairs []string) (string, error) {
+
+	var b strings.Builder
+
+	value := func(k string) (string, error) {
+		for i := 0; i < len(pairs); i += 2 {
+			if pairs[i] == k {
+				return pairs[i+1], nil
+			}
+		}
+		return "", fmt.Errorf("route %q requires parameter %q", name, k)
+	}
+
+	for i := 0; i < len(r.Path); i++ {
+		switch r.Path[i] {
+		default:
+			b.WriteByte(r.Path[i])
+		case ':':
+			k, cons, j := parameter(r.Path[i:])
+			v, err := value(k)
+			if err != nil {
+				return "", err
+			}
+			if v == "" {
+				return "", fmt.Errorf("route %q requires a value for parameter %q", name, k)
+			}
+			if fnc, _ := constraint(cons); fnc != nil && !fnc(v) {
+				return "", fmt.Errorf("route %q parameter %q does not match <%s>", name, k, cons)
+			}
+			b.WriteString(url.PathEscape(v))
+			i += j - 1
+		case '*':
+			v, err := value("*")
+			if err != nil {
+				return "", err
+			}
+			for k, s := range strings.Split(v, "/") {
+				if k > 0 {
+					b.WriteByte('/')
+				}
+				b.WriteString(url.PathEscape(s))
+			}
+		}
+	}
+
+	return b.String(), nil
+
 }
 
-func consumeIdent(pos int, path string) (s string, i int) {
-	for i = pos; i < len(path); i++ {
-		if path[i] == '/' || path[i] == ':' || path[i] == '*' {
-			break
+func (r *Route) rank() (rank int) {
+
+	for i := 0; i < len(r.Path); i++ {
+		switch r.Path[i] {
+		default:
+			rank++
+		case ':':
+			_, _, j := parameter(r.Path[i:])
+			rank += 100
+			i += j - 1
+		case '*':
+			rank += 10000
+		}
+	}
+
+	return
+
+}
+
+func (r *Route) validate() error {
+
+	var all bool
+
+	names := make(map[string]bool)
+
+	fail := func(reason string) error {
+		return &RouteError{Route: r, Reason: reason}
+	}
+
+	if len(r.Path) == 0 || r.Path[0] != '/' {
+		return fail("path must begin with a slash")
+	}
+
+	for i := 0; i < len(r.Path); i++ {
+		switch r.Path[i] {
+		case ':':
+			k, cons, j := parameter(r.Path[i:])
+			if len(k) == 0 {
+				return fail("path parameter must have a name")
+			}
+			if names[k] {
+				return fail(fmt.Sprintf("path parameter %q is used more than once", k))
+			}
+			if i+j < len(r.Path) && r.Path[i+j] != '/' {
+				return fail(fmt.Sprintf("path parameter %q must be followed by a slash", k))
+			}
+			if len(cons) > 0 && r.Path[i+j-1] != '>' {
+				return fail(fmt.Sprintf("path parameter %q constraint must be closed with >", k))
+			}
+			if _, err := constraint(cons); err != nil {
+				return fail(fmt.Sprintf("path parameter %q constraint is invalid: %v", k, err))
+			}
+			names[k] = true
+			i += j - 1
+		case '*':
+			if all {
+				return fail("path must only have 1 match all (*)")
+			}
+			if i != len(r.Path)-1 {
+				return fail("match all (*) must be at end of path")
+			}
+			all = true
 		}
 	}
-	return path[pos:i], i
+
+	return nil
+
 }
 
-func consumeChars(pos int, path string) (s string, i int) {
-	for i = pos; i < len(path); i++ {
-		if path[i] == ':' || path[i] == '*' {
-			break
+func (r *Route) params() (names []string) {
+
+	for i := 0; i < len(r.Path); i++ {
+		switch r.Path[i] {
+		case ':':
+			k, _, j := parameter(r.Path[i:])
+			names = append(names, k)
+			i += j - 1
+		case '*':
+			names = append(names, "*")
 		}
 	}
-	return path[pos:i], i
+
+	return
+
 }
 
-func consumeCount(pos int, path string, c int) (s string, i int) {
-	if len(path) < pos+c {
-		i = len(path)
-	} else {
-		i = pos + c
+func funcName(h HandlerFunc) string {
+	if h == nil {
+		return ""
+	}
+	if fnc := runtime.FuncForPC(reflect.ValueOf(h).Pointer()); fnc != nil {
+		return fnc.Name()
+	}
+	return ""
+}
+
+// caller returns the location of the code which registered the
+// route, skipping any frames from within the fibre package.
+func caller() string {
+
+	pc := make([]uintptr, 16)
+
+	frames := runtime.CallersFrames(pc[:runtime.Callers(3, pc)])
+
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/surrealdb/fibre.") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
 	}
-	return path[pos:i], i
+
 }
@@ -0,0 +1,729 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var testRoutes = []string{
+	"/",
+	"/users",
+	"/users/new",
+	"/users/newbie",
+	"/users/:id",
+	"/users/:id/edit",
+	"/users/:id/posts",
+	"/users/:id/posts/:post",
+	"/users/:id/posts/:post/comments",
+	"/posts",
+	"/posts/:post",
+	"/posts/:post/comments",
+	"/search",
+	"/static/*",
+	"/api/v1/status",
+	"/api/v1/keys/:key",
+	"/api/v1/keys/:key/versions/:version",
+	"/api/v1/*",
+}
+
+// testServer returns a server with a GET route for each test
+// route, which responds with the route path and its params.
+func testServer() *Fibre {
+
+	f := Server()
+
+	for _, p := range testRoutes {
+		f.Get(p, func(c *Context) error {
+			out := c.Path()
+			for i, k := range c.pnames {
+				out += " " + k + "=" + c.pvalues[i]
+			}
+			return c.Text(200, out)
+		})
+	}
+
+	return f
+
+}
+
+func TestRouterFind(t *testing.T) {
+
+	f := testServer()
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		// static routes
+		{"/", 200, "/"},
+		{"/users", 200, "/users"},
+		{"/search", 200, "/search"},
+		{"/api/v1/status", 200, "/api/v1/status"},
+		// static routes win over params
+		{"/users/new", 200, "/users/new"},
+		// backtracking from a partial static match
+		{"/users/newbie", 200, "/users/newbie"},
+		{"/users/newb", 200, "/users/:id id=newb"},
+		{"/users/newbies", 200, "/users/:id id=newbies"},
+		{"/users/new/edit", 200, "/users/:id/edit id=new"},
+		// param capture
+		{"/users/42", 200, "/users/:id id=42"},
+		{"/users/42/edit", 200, "/users/:id/edit id=42"},
+		{"/users/42/posts/7", 200, "/users/:id/posts/:post id=42 post=7"},
+		{"/users/42/posts/7/comments", 200, "/users/:id/posts/:post/comments id=42 post=7"},
+		{"/api/v1/keys/abc/versions/3", 200, "/api/v1/keys/:key/versions/:version key=abc version=3"},
+		// params win over match all
+		{"/api/v1/keys/abc", 200, "/api/v1/keys/:key key=abc"},
+		{"/api/v1/other", 200, "/api/v1/* *=other"},
+		{"/api/v1/keys/abc/other", 200, "/api/v1/* *=keys/abc/other"},
+		{"/static/css/app.css", 200, "/static/* *=css/app.css"},
+		{"/static/", 200, "/static/* *="},
+		// trailing slashes
+		{"/users/", 200, "/users"},
+		{"/users/42/", 200, "/users/:id id=42"},
+		{"/users/42/posts/7/", 200, "/users/:id/posts/:post id=42 post=7"},
+		{"/static", 200, "/static/* *="},
+		// missing routes
+		{"/missing", 404, ""},
+		{"/users/42/unknown", 404, ""},
+		{"/api/v2/status", 404, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(GET, test.path, nil)
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, req)
+		if res.Code != test.code {
+			t.Errorf("GET %s: expected status %d, got %d", test.path, test.code, res.Code)
+			continue
+		}
+		if test.code == 200 && res.Body.String() != test.body {
+			t.Errorf("GET %s: expected %q, got %q", test.path, test.body, res.Body.String())
+		}
+	}
+
+}
+
+func TestRouterPriority(t *testing.T) {
+
+	f := Server()
+
+	text := func(s string) HandlerFunc {
+		return func(c *Context) error {
+			return c.Text(200, s)
+		}
+	}
+
+	// Register in reverse order of priority
+	f.Get("/files/*", text("any"))
+	f.Get("/files/:name", text("param"))
+	f.Get("/files/index", text("static"))
+
+	tests := map[string]string{
+		"/files/index":    "static",
+		"/files/other":    "param",
+		"/files/other/of": "any",
+	}
+
+	for path, body := range tests {
+		req := httptest.NewRequest(GET, path, nil)
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, req)
+		if res.Body.String() != body {
+			t.Errorf("GET %s: expected %q, got %q", path, body, res.Body.String())
+		}
+	}
+
+}
+
+// rankRoute is the route matcher used before the tree router,
+// which tests every route for the method in order of rank.
+type rankRoute struct {
+	rank int
+	path string
+	hand HandlerFunc
+}
+
+type rankRouter map[string][]*rankRoute
+
+func (r rankRouter) add(meth, path string, hand HandlerFunc) {
+	route := &rankRoute{rank: (&Route{Path: path}).rank(), path: path, hand: hand}
+	r[meth] = append(r[meth], route)
+	sort.SliceStable(r[meth], func(i, j int) bool {
+		return r[meth][i].rank < r[meth][j].rank
+	})
+}
+
+func (r rankRouter) find(meth, path string) (*rankRoute, url.Values) {
+	for _, route := range r[meth] {
+		if pa, ok := route.test(path); ok {
+			return route, pa
+		}
+	}
+	return nil, nil
+}
+
+func (r *rankRoute) test(path string) (url.Values, bool) {
+
+	var i, j int
+
+	param := make(url.Values)
+
+	for i < len(r.path) {
+		switch r.path[i] {
+		case '*':
+			param.Add("*", path[j:])
+			i, j = i+1, len(path)
+		case ':':
+			k := r.path[i+1:]
+			if n := strings.IndexByte(k, '/'); n >= 0 {
+				k = k[:n]
+			}
+			v := path[j:]
+			if n := strings.IndexByte(v, '/'); n >= 0 {
+				v = v[:n]
+			}
+			if len(v) == 0 {
+				return nil, false
+			}
+			param.Add(k, v)
+			i, j = i+1+len(k), j+len(v)
+		default:
+			k := r.path[i:]
+			if n := strings.IndexAny(k, ":*"); n >= 0 {
+				k = k[:n]
+			}
+			if !strings.HasPrefix(path[j:], k) {
+				return nil, false
+			}
+			i, j = i+len(k), j+len(k)
+		}
+	}
+
+	return param, j == len(path)
+
+}
+
+var benchPaths = map[string]string{
+	"Static": "/api/v1/status",
+	"Param":  "/users/42/posts/7/comments",
+	"Any":    "/static/css/app.css",
+	"Miss":   "/missing/path",
+}
+
+func BenchmarkTree(b *testing.B) {
+
+	f := testServer()
+
+	c := NewContext(new(Request), new(Response), f)
+
+	for _, name := range []string{"Static", "Param", "Any", "Miss"} {
+		path := benchPaths[name]
+		c.reset(httptest.NewRequest(GET, path, nil), httptest.NewRecorder(), f)
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f.router.Find(GET, path, c)
+			}
+		})
+	}
+
+}
+
+func BenchmarkRanker(b *testing.B) {
+
+	r := rankRouter{}
+
+	for _, p := range testRoutes {
+		r.add(GET, p, notFound)
+	}
+
+	for _, name := range []string{"Static", "Param", "Any", "Miss"} {
+		path := benchPaths[name]
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r.find(GET, path)
+			}
+		})
+	}
+
+}
+
+func TestRankerMatches(t *testing.T) {
+
+	r := rankRouter{}
+
+	for _, p := range testRoutes {
+		r.add(GET, p, notFound)
+	}
+
+	f := testServer()
+
+	c := NewContext(new(Request), new(Response), f)
+
+	for name, path := range benchPaths {
+		var want string
+		if route, _ := r.find(GET, path); route != nil {
+			want = route.path
+		}
+		c.reset(httptest.NewRequest(GET, path, nil), httptest.NewRecorder(), f)
+		f.router.Find(GET, path, c)
+		if c.Path() != want {
+			t.Errorf("%s: ranker matched %q, tree matched %q", name, want, c.Path())
+		}
+	}
+
+}
+
+func TestRouterHost(t *testing.T) {
+
+	f := Server()
+
+	f.Host("{tenantID}.Example.com").Get("/users/:id", func(c *Context) error {
+		return c.Text(200, c.Param("tenantID")+" "+c.Param("id"))
+	})
+
+	tests := []struct {
+		host string
+		code int
+		body string
+	}{
+		{"acme.example.com", 200, "acme 42"},
+		{"acme.EXAMPLE.com:8000", 200, "acme 42"},
+		{"example.com", 404, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(GET, "http://"+test.host+"/users/42", nil)
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, req)
+		if res.Code != test.code {
+			t.Errorf("GET %s: expected status %d, got %d", test.host, test.code, res.Code)
+			continue
+		}
+		if test.code == 200 && res.Body.String() != test.body {
+			t.Errorf("GET %s: expected %q, got %q", test.host, test.body, res.Body.String())
+		}
+	}
+
+	// HEAD requests use the GET route with the host params
+	for _, test := range tests {
+		req := httptest.NewRequest(HEAD, "http://"+test.host+"/users/42", nil)
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, req)
+		if res.Code != test.code {
+			t.Errorf("HEAD %s: expected status %d, got %d", test.host, test.code, res.Code)
+			continue
+		}
+		if test.code == 200 && res.Header().Get(HeaderContentLength) != strconv.Itoa(len(test.body)) {
+			t.Errorf("HEAD %s: expected length %d, got %q", test.host, len(test.body), res.Header().Get(HeaderContentLength))
+		}
+	}
+
+}
+
+func TestRouterTrailingSlash(t *testing.T) {
+
+	f := testServer()
+
+	f.SetCaseInsensitive(true)
+
+	tests := map[string]string{
+		"/USERS/":          "/users",
+		"/Users/42/Edit/":  "/users/:id/edit id=42",
+		"/POSTS/":          "/posts",
+		"/Static":          "/static/* *=",
+		"/users/newbie/":   "/users/newbie",
+		"/posts/7/":        "/posts/:post post=7",
+		"/posts/7/comment": "",
+	}
+
+	for path, body := range tests {
+		req := httptest.NewRequest(GET, path, nil)
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, req)
+		if res.Body.String() != body && (body != "" || res.Code != 404) {
+			t.Errorf("GET %s: expected %q, got %d %q", path, body, res.Code, res.Body.String())
+		}
+	}
+
+	f.SetTrailingSlash("strict")
+
+	req := httptest.NewRequest(GET, "/users/", nil)
+	res := httptest.NewRecorder()
+	f.ServeHTTP(res, req)
+	if res.Code != 404 {
+		t.Errorf("GET /users/: expected status 404 with strict slashes, got %d", res.Code)
+	}
+
+}
+
+func TestRouterReplaceRemove(t *testing.T) {
+
+	f := Server()
+
+	text := func(s string) HandlerFunc {
+		return func(c *Context) error {
+			return c.Text(200, s)
+		}
+	}
+
+	f.Get("/users", text("default"))
+
+	g := f.Host("{tenant}.example.com").Group("/api")
+
+	g.Get("/users", text("host"))
+
+	get := func(host string) string {
+		req := httptest.NewRequest(GET, "http://"+host+"/api/users", nil)
+		if host == "" {
+			req = httptest.NewRequest(GET, "/users", nil)
+		}
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, req)
+		return strconv.Itoa(res.Code) + " " + res.Body.String()
+	}
+
+	if _, err := g.Replace(GET, "/users", text("replaced")); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := get("acme.example.com"); v != "200 replaced" {
+		t.Errorf("expected replaced host route, got %q", v)
+	}
+
+	if f.Router().Remove(GET, "/api/users") {
+		t.Errorf("expected no default route to be removed")
+	}
+
+	if !g.Remove(GET, "/users") {
+		t.Errorf("expected the host route to be removed")
+	}
+
+	if g.Remove(GET, "/users") {
+		t.Errorf("expected the host route to be removed only once")
+	}
+
+	if v := get("acme.example.com"); !strings.HasPrefix(v, "404 ") {
+		t.Errorf("expected removed host route, got %q", v)
+	}
+
+	if v := get(""); v != "200 default" {
+		t.Errorf("expected default route to remain, got %q", v)
+	}
+
+	if n := len(f.Router().Routes()); n != 1 {
+		t.Errorf("expected 1 route, got %d", n)
+	}
+
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+
+	ok := func(c *Context) error {
+		return c.Text(200, c.Request().Method)
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(f *Fibre)
+		meth    string
+		path    string
+		code    int
+		allowed string
+	}{
+		{
+			name: "registered method",
+			meth: GET, path: "/items/1", code: 200,
+		},
+		{
+			name: "other method",
+			meth: PUT, path: "/items/1", code: 405,
+			allowed: "HEAD, GET, POST, OPTIONS",
+		},
+		{
+			name: "automatic options",
+			meth: OPTIONS, path: "/items/1", code: 204,
+			allowed: "HEAD, GET, POST, OPTIONS",
+		},
+		{
+			name: "explicit options",
+			setup: func(f *Fibre) {
+				f.Options("/items/:id", ok)
+			},
+			meth: OPTIONS, path: "/items/1", code: 200,
+		},
+		{
+			name: "automatic options disabled",
+			setup: func(f *Fibre) {
+				f.SetAutoOptions(false)
+			},
+			meth: OPTIONS, path: "/items/1", code: 405,
+			allowed: "HEAD, GET, POST",
+		},
+		{
+			name: "method not allowed disabled",
+			setup: func(f *Fibre) {
+				f.SetMethodNotAllowed(false)
+			},
+			meth: PUT, path: "/items/1", code: 404,
+		},
+		{
+			name: "missing path",
+			meth: PUT, path: "/other", code: 404,
+		},
+		{
+			name: "catch all for another method",
+			setup: func(f *Fibre) {
+				f.Get("/*", ok)
+			},
+			meth: DELETE, path: "/other", code: 405,
+			allowed: "HEAD, GET, OPTIONS",
+		},
+		{
+			name: "catch all with method not allowed disabled",
+			setup: func(f *Fibre) {
+				f.Get("/*", ok)
+				f.SetMethodNotAllowed(false)
+			},
+			meth: DELETE, path: "/other", code: 404,
+		},
+		{
+			name: "trailing slash",
+			meth: PUT, path: "/items/1/", code: 405,
+			allowed: "HEAD, GET, POST, OPTIONS",
+		},
+	}
+
+	for _, test := range tests {
+
+		f := Server()
+
+		f.Get("/items/:id", ok)
+		f.Post("/items/:id", ok)
+
+		if test.setup != nil {
+			test.setup(f)
+		}
+
+		req := httptest.NewRequest(test.meth, test.path, nil)
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, req)
+
+		if res.Code != test.code {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.code, res.Code)
+		}
+
+		if v := res.Header().Get(HeaderAllow); v != test.allowed {
+			t.Errorf("%s: expected Allow %q, got %q", test.name, test.allowed, v)
+		}
+
+	}
+
+}
+
+func TestRouterURL(t *testing.T) {
+
+	f := Server()
+
+	ok := func(c *Context) error {
+		return nil
+	}
+
+	f.Get("/users/:id", ok).SetName("user")
+	f.Get("/users/:id/posts/:post", ok).SetName("post")
+	f.Get("/items/:id<int>", ok).SetName("item")
+	f.Get("/files/*", ok).SetName("files")
+	f.Host("{tenant}.example.com").Get("/home", ok).SetName("home")
+
+	tests := []struct {
+		name  string
+		pairs []string
+		url   string
+		fail  bool
+	}{
+		{name: "user", pairs: []string{"id", "42"}, url: "/users/42"},
+		{name: "user", pairs: []string{"id", "a b/c?d"}, url: "/users/a%20b%2Fc%3Fd"},
+		{name: "post", pairs: []string{"post", "7", "id", "42"}, url: "/users/42/posts/7"},
+		{name: "item", pairs: []string{"id", "7"}, url: "/items/7"},
+		{name: "item", pairs: []string{"id", "seven"}, fail: true},
+		{name: "files", pairs: []string{"*", "css/app one.css"}, url: "/files/css/app%20one.css"},
+		{name: "files", pairs: []string{"*", ""}, url: "/files/"},
+		{name: "home", url: "/home"},
+		{name: "user", pairs: []string{"other", "42"}, fail: true},
+		{name: "user", pairs: []string{"id", ""}, fail: true},
+		{name: "user", pairs: []string{"id"}, fail: true},
+		{name: "missing", fail: true},
+	}
+
+	for _, test := range tests {
+		url, err := f.Router().URL(test.name, test.pairs...)
+		if test.fail {
+			if err == nil {
+				t.Errorf("%s %v: expected an error, got %q", test.name, test.pairs, url)
+			}
+			if v := f.URL(test.name, test.pairs...); v != "" {
+				t.Errorf("%s %v: expected an empty url, got %q", test.name, test.pairs, v)
+			}
+			continue
+		}
+		if err != nil || url != test.url {
+			t.Errorf("%s %v: expected %q, got %q %v", test.name, test.pairs, test.url, url, err)
+		}
+	}
+
+}
+
+func TestRouterValidate(t *testing.T) {
+
+	f := Server()
+
+	ok := func(c *Context) error {
+		return nil
+	}
+
+	f.Get("/users/:id", ok).SetName("user")
+	f.Host("{tenant}.example.com").Get("/", ok)
+
+	tests := []struct {
+		name   string
+		add    func() error
+		reason string
+	}{
+		{"no slash", func() error {
+			_, err := f.Router().Add(GET, "users", ok)
+			return err
+		}, "path must begin with a slash"},
+		{"empty param", func() error {
+			_, err := f.Router().Add(GET, "/users/:/posts", ok)
+			return err
+		}, "path parameter must have a name"},
+		{"duplicate param", func() error {
+			_, err := f.Router().Add(GET, "/users/:id/posts/:id", ok)
+			return err
+		}, `path parameter "id" is used more than once`},
+		{"param suffix", func() error {
+			_, err := f.Router().Add(GET, "/users/:id<int>x", ok)
+			return err
+		}, `path parameter "id" must be followed by a slash`},
+		{"unclosed constraint", func() error {
+			_, err := f.Router().Add(GET, "/users/:id<int", ok)
+			return err
+		}, `path parameter "id" constraint must be closed with >`},
+		{"invalid constraint", func() error {
+			_, err := f.Router().Add(GET, "/users/:id<[a-z>", ok)
+			return err
+		}, `path parameter "id" constraint is invalid`},
+		{"match all", func() error {
+			_, err := f.Router().Add(GET, "/files/*/x", ok)
+			return err
+		}, "match all (*) must be at end of path"},
+		{"conflict", func() error {
+			_, err := f.Router().Add(GET, "/users/:id", ok)
+			return err
+		}, "conflicts with route GET /users/:id"},
+		{"ambiguous host", func() error {
+			_, err := f.Host("{name}.example.com").Replace(GET, "/", ok)
+			return err
+		}, `host "{name}.example.com" is ambiguous with host`},
+		{"reused name", func() error {
+			f.Get("/people/:id", ok).SetName("user")
+			return nil
+		}, `reuses the name "user" of route GET /users/:id`},
+	}
+
+	for _, test := range tests {
+		err := test.add()
+		if err == nil && test.name != "reused name" {
+			t.Errorf("%s: expected an error, got none", test.name)
+			continue
+		}
+		if err != nil {
+			if _, ok := err.(*RouteError); !ok {
+				t.Errorf("%s: expected a RouteError, got %T", test.name, err)
+			}
+			if !strings.Contains(err.Error(), test.reason) {
+				t.Errorf("%s: expected %q in %q", test.name, test.reason, err.Error())
+			}
+		}
+	}
+
+	errs := f.Router().Validate()
+
+	if len(errs) != len(tests) {
+		t.Fatalf("expected %d errors from Validate, got %d: %v", len(tests), len(errs), errs)
+	}
+
+	for i, test := range tests {
+		if !strings.Contains(errs[i].Error(), test.reason) {
+			t.Errorf("%s: expected %q in %q", test.name, test.reason, errs[i].Error())
+		}
+	}
+
+	if url, err := f.Router().URL("user", "id", "1"); err != nil || url != "/users/1" {
+		t.Errorf("expected the name to keep its route, got %q %v", url, err)
+	}
+
+	func() {
+		defer func() {
+			if _, ok := recover().(*RouteError); !ok {
+				t.Errorf("expected Get to panic with a RouteError for a conflicting route")
+			}
+		}()
+		f.Get("/users/:id", ok)
+	}()
+
+}
+
+func TestRouterAllowSnapshot(t *testing.T) {
+
+	f := Server()
+
+	ok := func(c *Context) error {
+		return nil
+	}
+
+	f.Get("/users", ok)
+	f.Post("/users", ok)
+
+	c := NewContext(new(Request), new(Response), f)
+	res := httptest.NewRecorder()
+	c.reset(httptest.NewRequest(DELETE, "/users", nil), res, f)
+
+	h := f.Router().Find(DELETE, "/users", c)
+
+	// Change the routes after the request has been matched
+	f.Put("/users", ok)
+	f.Router().Remove(POST, "/users")
+
+	h(c)
+
+	if res.Code != 405 {
+		t.Fatalf("expected code 405, got %d", res.Code)
+	}
+
+	if v := res.Header().Get(HeaderAllow); v != "HEAD, GET, POST, OPTIONS" {
+		t.Errorf("expected the Allow header of the matched table, got %q", v)
+	}
+
+}
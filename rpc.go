@@ -55,24 +55,28 @@ type RPCNotification struct {
 }
 
 // Rpc adds a route > handler to the router for a jsonrpc endpoint.
-func (f *Fibre) Rpc(p string, i interface{}) {
+func (f *Fibre) Rpc(p string, i interface{}, m ...MiddlewareFunc) {
+	routeRpc(f.add, p, i, m...)
+}
+
+func routeRpc(add func(string, string, HandlerFunc, ...MiddlewareFunc) *Route, p string, i interface{}, m ...MiddlewareFunc) {
 
-	f.router.Add(OPTIONS, p, func(c *Context) (err error) {
+	add(OPTIONS, p, func(c *Context) (err error) {
 		return c.Code(200)
-	})
+	}, m...)
 
-	f.router.Add(POST, p, func(c *Context) (err error) {
+	add(POST, p, func(c *Context) (err error) {
 		req := &RPCRequest{}
 		c.Bind(req)
 		if res := rpc(req, c, i); res != nil {
 			return c.Send(200, res)
 		}
 		return c.Code(200)
-	})
+	}, m...)
 
-	f.router.Add(GET, p, func(c *Context) (err error) {
+	add(GET, p, func(c *Context) (err error) {
 
-		if err = c.Upgrade("json", "cbor", "pack"); err != nil {
+		if err = c.Upgrade(c.fibre.codecs.Protocols()...); err != nil {
 			return
 		}
 
@@ -84,22 +88,26 @@ func (f *Fibre) Rpc(p string, i interface{}) {
 				return err
 			case req := <-recv:
 				if req.Async {
-					go func() {
+					go func(c *Context) {
 						if res := rpc(req, c, i); res != nil {
-							send <- res
+							select {
+							case send <- res:
+							case <-c.Context().Done():
+							}
 						}
-					}()
+					}(c.Clone())
 				} else {
 					if res := rpc(req, c, i); res != nil {
-						send <- res
+						select {
+						case send <- res:
+						case <-c.Context().Done():
+						}
 					}
 				}
 			}
 		}
 
-		return nil
-
-	})
+	}, m...)
 
 }
 
@@ -0,0 +1,279 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+// flushEvery is how often a sequence stream is flushed to the client,
+// so that values are sent even while the source is blocked.
+const flushEvery = 100 * time.Millisecond
+
+// Iterator returns the next value to stream, or io.EOF once
+// there are no more values to stream.
+type Iterator func() (interface{}, error)
+
+// Decoder decodes a sequence of values from a request body.
+type Decoder struct {
+	reader *bufio.Reader
+	codec  Codec
+	lines  bool
+}
+
+// StreamJSONLines streams each value from the source as a line of
+// json, where the source is either a channel or an Iterator. The
+// response is flushed periodically, and whenever the source has
+// no value ready, and the stream stops if the client goes away.
+func (c *Context) StreamJSONLines(code int, src interface{}) error {
+	return c.sequence(code, "application/x-ndjson", "application/json", []byte("\n"), src)
+}
+
+// StreamCBORSequence streams each value from the source as a cbor
+// sequence, as described in RFC 8742, where the source is either
+// a channel or an Iterator.
+func (c *Context) StreamCBORSequence(code int, src interface{}) error {
+	return c.sequence(code, "application/cbor-seq", "application/cbor", nil, src)
+}
+
+// StreamPACKSequence streams each value from the source as a series
+// of msgpack values, where the source is either a channel or an
+// Iterator.
+func (c *Context) StreamPACKSequence(code int, src interface{}) error {
+	return c.sequence(code, "application/msgpack", "application/msgpack", nil, src)
+}
+
+// BindJSONLines returns a decoder for a request body of json lines.
+func (c *Context) BindJSONLines() (*Decoder, error) {
+	return c.decoder("application/json", true)
+}
+
+// BindCBORSequence returns a decoder for a request body containing
+// a cbor sequence, as described in RFC 8742.
+func (c *Context) BindCBORSequence() (*Decoder, error) {
+	return c.decoder("application/cbor", false)
+}
+
+// BindPACKSequence returns a decoder for a request body containing
+// a series of msgpack values.
+func (c *Context) BindPACKSequence() (*Decoder, error) {
+	return c.decoder("application/msgpack", false)
+}
+
+// Next decodes the next value in the request body into the object,
+// returning io.EOF once the whole body has been read. Any other
+// error, including a body which could not be read to the end, is
+// returned as a 400 error.
+func (d *Decoder) Next(v interface{}) error {
+
+	if d.lines {
+		for {
+			b, err := d.reader.ReadByte()
+			if err != nil {
+				return d.err(err)
+			}
+			if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+				d.reader.UnreadByte()
+				break
+			}
+		}
+	}
+
+	if _, err := d.reader.Peek(1); err != nil {
+		return d.err(err)
+	}
+
+	if err := d.codec.Decode(d.reader, v); err != nil {
+		return NewHTTPError(400, err.Error())
+	}
+
+	return nil
+
+}
+
+// err returns io.EOF at the end of the body, or a 400 error if
+// the body could not be read.
+func (d *Decoder) err(err error) error {
+	if err == io.EOF {
+		return io.EOF
+	}
+	return NewHTTPError(400, err.Error())
+}
+
+func (c *Context) decoder(mime string, lines bool) (*Decoder, error) {
+
+	cod := c.fibre.codecs.Type(mime)
+	if cod == nil {
+		return nil, NewHTTPError(500, fmt.Sprintf("No codec is registered for %s", mime))
+	}
+
+	return &Decoder{
+		reader: bufio.NewReader(c.Request().Body),
+		codec:  cod,
+		lines:  lines,
+	}, nil
+
+}
+
+func (c *Context) sequence(code int, mime, kind string, sep []byte, src interface{}) error {
+
+	cod := c.fibre.codecs.Type(kind)
+	if cod == nil {
+		return NewHTTPError(500, fmt.Sprintf("No codec is registered for %s", kind))
+	}
+
+	next, err := c.iterate(src)
+	if err != nil {
+		return err
+	}
+
+	s, err := c.stream(code, mime)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// Flush the stream on a timer, so that values which have been
+	// written are sent while an Iterator is blocked on the next one
+	go func() {
+		t := time.NewTicker(flushEvery)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-s.Done():
+				return
+			case <-t.C:
+				s.Flush()
+			}
+		}
+	}()
+
+	var buf bytes.Buffer
+
+	for {
+
+		v, wait, err := next()
+		if err == io.EOF {
+			s.Flush()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if wait {
+			s.Flush()
+			continue
+		}
+
+		// Encode each value before writing it, so that
+		// a flush never sends part of a value
+		buf.Reset()
+
+		if err := cod.Encode(&buf, v); err != nil {
+			return err
+		}
+
+		buf.Write(sep)
+
+		if _, err := s.Write(buf.Bytes()); err != nil {
+			return err
+		}
+
+	}
+
+}
+
+// iterate returns a function which returns each value from the
+// source. For a channel, the function returns with wait set if
+// no value is ready, so that the response can be flushed before
+// waiting. An error is returned once the request is cancelled.
+func (c *Context) iterate(src interface{}) (func() (interface{}, bool, error), error) {
+
+	ctx := c.Request().Request.Context()
+
+	if fnc, ok := src.(Iterator); ok {
+		return func() (interface{}, bool, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, false, err
+			}
+			v, err := fnc()
+			return v, false, err
+		}, nil
+	}
+
+	if fnc, ok := src.(func() (interface{}, error)); ok {
+		return c.iterate(Iterator(fnc))
+	}
+
+	ch := reflect.ValueOf(src)
+
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.RecvDir == 0 {
+		return nil, fmt.Errorf("fibre: cannot stream values from %T", src)
+	}
+
+	ready := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectDefault},
+	}
+
+	block := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+
+	waited := false
+
+	return func() (interface{}, bool, error) {
+
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+
+		cases := ready
+
+		if waited {
+			cases, waited = block, false
+		}
+
+		i, v, ok := reflect.Select(cases)
+
+		if i == 1 && cases[1].Dir == reflect.SelectDefault {
+			waited = true
+			return nil, true, nil
+		}
+
+		if i == 1 {
+			return nil, false, ctx.Err()
+		}
+
+		if !ok {
+			return nil, false, io.EOF
+		}
+
+		return v.Interface(), false, nil
+
+	}, nil
+
+}
@@ -0,0 +1,190 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failReader returns the data, and then fails with the error.
+type failReader struct {
+	data io.Reader
+	err  error
+}
+
+func (r *failReader) Read(p []byte) (int, error) {
+	if n, err := r.data.Read(p); err != io.EOF {
+		return n, err
+	}
+	return 0, r.err
+}
+
+func TestDecoderNext(t *testing.T) {
+
+	f := Server()
+
+	tests := []struct {
+		name  string
+		body  func(w http.ResponseWriter) io.ReadCloser
+		count int
+		code  int
+	}{
+		{
+			name: "complete",
+			body: func(w http.ResponseWriter) io.ReadCloser {
+				return io.NopCloser(strings.NewReader("{\"n\":1}\n\n{\"n\":2}\r\n{\"n\":3}\n"))
+			},
+			count: 3,
+		},
+		{
+			name: "truncated value",
+			body: func(w http.ResponseWriter) io.ReadCloser {
+				return io.NopCloser(strings.NewReader("{\"n\":1}\n{\"n\":"))
+			},
+			count: 1,
+			code:  400,
+		},
+		{
+			name: "dropped connection",
+			body: func(w http.ResponseWriter) io.ReadCloser {
+				return io.NopCloser(&failReader{strings.NewReader("{\"n\":1}\n"), io.ErrUnexpectedEOF})
+			},
+			count: 1,
+			code:  400,
+		},
+		{
+			name: "body too large",
+			body: func(w http.ResponseWriter) io.ReadCloser {
+				return http.MaxBytesReader(w, io.NopCloser(strings.NewReader("{\"n\":1}\n{\"n\":2}\n")), 9)
+			},
+			count: 1,
+			code:  400,
+		},
+	}
+
+	for _, test := range tests {
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest(POST, "/", nil)
+		req.Body = test.body(res)
+
+		c := NewContext(new(Request), new(Response), f)
+		c.reset(req, res, f)
+
+		d, err := c.BindJSONLines()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var count int
+
+		for {
+			var v struct {
+				N int `json:"n"`
+			}
+			err = d.Next(&v)
+			if err != nil {
+				break
+			}
+			if count++; v.N != count {
+				t.Errorf("%s: expected value %d, got %d", test.name, count, v.N)
+			}
+		}
+
+		if count != test.count {
+			t.Errorf("%s: expected %d values, got %d", test.name, test.count, count)
+		}
+
+		var he *HTTPError
+
+		switch {
+		case test.code == 0 && err != io.EOF:
+			t.Errorf("%s: expected io.EOF, got %v", test.name, err)
+		case test.code != 0 && (!errors.As(err, &he) || he.Code() != test.code):
+			t.Errorf("%s: expected a %d error, got %v", test.name, test.code, err)
+		}
+
+	}
+
+}
+
+func TestDecoderMissingCodec(t *testing.T) {
+
+	f := Server()
+
+	f.codecs = &Codecs{}
+
+	c := NewContext(new(Request), new(Response), f)
+	c.reset(httptest.NewRequest(POST, "/", strings.NewReader("{}")), httptest.NewRecorder(), f)
+
+	if _, err := c.BindCBORSequence(); err == nil {
+		t.Errorf("expected an error when no codec is registered")
+	}
+
+}
+
+func TestStreamBlockingIterator(t *testing.T) {
+
+	f := Server()
+
+	release := make(chan struct{})
+
+	f.Get("/", func(c *Context) error {
+		n := 0
+		return c.StreamJSONLines(200, Iterator(func() (interface{}, error) {
+			if n++; n == 1 {
+				return map[string]int{"n": 1}, nil
+			}
+			<-release
+			return nil, io.EOF
+		}))
+	})
+
+	s := httptest.NewServer(f)
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	line := make(chan string, 1)
+
+	go func() {
+		b, _ := bufio.NewReader(res.Body).ReadString('\n')
+		line <- b
+	}()
+
+	// The first value must arrive while the Iterator is blocked
+	select {
+	case v := <-line:
+		if v != "{\"n\":1}\n" {
+			t.Errorf("expected the first value, got %q", v)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("expected the first value to be flushed while the iterator is blocked")
+	}
+
+	close(release)
+
+}
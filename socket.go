@@ -15,11 +15,13 @@
 package fibre
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
 	"time"
 
-	"encoding/xml"
 	"github.com/gorilla/websocket"
-	"github.com/ugorji/go/codec"
 )
 
 var ping = []byte(nil)
@@ -30,11 +32,12 @@ type Socket struct {
 	context *Context
 	fibre   *Fibre
 	notify  chan<- *RPCNotification
+	done    <-chan struct{}
 }
 
 // NewSocket creates a new instance of Response.
 func NewSocket(i *websocket.Conn, c *Context, f *Fibre) *Socket {
-	return &Socket{i, c, f, nil}
+	return &Socket{i, c, f, nil, nil}
 }
 
 func (s *Socket) err(err error) error {
@@ -44,6 +47,10 @@ func (s *Socket) err(err error) error {
 	return NewHTTPError(400)
 }
 
+// rpc starts reading requests from, and writing responses to, the
+// socket. The context of the request is replaced with a context
+// which is cancelled as soon as the connection drops, so that any
+// rpc method which is still running can stop its work.
 func (s *Socket) rpc() (chan<- *RPCResponse, <-chan *RPCRequest, chan error) {
 
 	s.SetPongHandler(func(msg string) error {
@@ -54,30 +61,35 @@ func (s *Socket) rpc() (chan<- *RPCResponse, <-chan *RPCRequest, chan error) {
 	send := make(chan *RPCResponse)
 	recv := make(chan *RPCRequest)
 	quit := make(chan error, 1)
-	exit := make(chan int, 1)
-	kind := s.Subprotocol()
+	once := sync.Once{}
+	mime, _ := s.fibre.codecs.Protocol(s.Subprotocol())
 
-	s.notify = noti
+	ctx, cancel := context.WithCancel(s.context.Context())
+
+	s.context.WithContext(ctx)
+
+	s.notify, s.done = noti, ctx.Done()
+
+	stop := func(code int, err error) {
+		once.Do(func() {
+			s.Close(code)
+			quit <- s.err(err)
+			cancel()
+		})
+	}
 
 	go func() {
-	loop:
 		for {
 			select {
-			case <-exit:
-				break loop
+			case <-ctx.Done():
+				return
 			case <-time.After(25 * time.Second):
 
-				var err error
-
 				var dead = time.Now().Add(5 * time.Second)
 
-				err = s.WriteControl(websocket.PingMessage, ping, dead)
-
-				if err != nil {
-					s.Close(websocket.CloseNoStatusReceived)
-					quit <- s.err(err)
-					exit <- 0
-					break loop
+				if err := s.WriteControl(websocket.PingMessage, ping, dead); err != nil {
+					stop(websocket.CloseNoStatusReceived, err)
+					return
 				}
 
 			}
@@ -85,84 +97,39 @@ func (s *Socket) rpc() (chan<- *RPCResponse, <-chan *RPCRequest, chan error) {
 	}()
 
 	go func() {
-	loop:
 		for {
-			select {
-			case <-exit:
-				break loop
-			default:
-
-				var err error
-				var req RPCRequest
-
-				switch kind {
-				case "json":
-					err = s.ReadJSON(&req)
-				case "cbor":
-					err = s.ReadCBOR(&req)
-				case "pack":
-					err = s.ReadPACK(&req)
-				}
 
-				if err != nil {
-					s.Close(websocket.CloseUnsupportedData)
-					quit <- s.err(err)
-					exit <- 0
-					break loop
-				}
+			var req RPCRequest
 
-				recv <- &req
+			if err := s.read(mime, &req); err != nil {
+				stop(websocket.CloseUnsupportedData, err)
+				return
+			}
 
+			select {
+			case <-ctx.Done():
+				return
+			case recv <- &req:
 			}
+
 		}
 	}()
 
 	go func() {
-	loop:
 		for {
 			select {
-			case <-exit:
-				break loop
+			case <-ctx.Done():
+				return
 			case res := <-noti:
-
-				var err error
-
-				switch kind {
-				case "json":
-					err = s.SendJSON(res)
-				case "cbor":
-					err = s.SendCBOR(res)
-				case "pack":
-					err = s.SendPACK(res)
-				}
-
-				if err != nil {
-					s.Close(websocket.CloseUnsupportedData)
-					quit <- s.err(err)
-					exit <- 0
-					break loop
+				if err := s.write(mime, res); err != nil {
+					stop(websocket.CloseUnsupportedData, err)
+					return
 				}
-
 			case res := <-send:
-
-				var err error
-
-				switch kind {
-				case "json":
-					err = s.SendJSON(res)
-				case "cbor":
-					err = s.SendCBOR(res)
-				case "pack":
-					err = s.SendPACK(res)
+				if err := s.write(mime, res); err != nil {
+					stop(websocket.CloseUnsupportedData, err)
+					return
 				}
-
-				if err != nil {
-					s.Close(websocket.CloseUnsupportedData)
-					quit <- s.err(err)
-					exit <- 0
-					break loop
-				}
-
 			}
 		}
 	}()
@@ -175,9 +142,14 @@ func (s *Socket) Close(code int) error {
 	return s.Conn.Close()
 }
 
+// Notify sends a notification to the socket, unless the
+// connection has already dropped.
 func (s *Socket) Notify(val *RPCNotification) {
 	if s.notify != nil {
-		s.notify <- val
+		select {
+		case s.notify <- val:
+		case <-s.done:
+		}
 	}
 }
 
@@ -188,38 +160,22 @@ func (s *Socket) Read() (int, []byte, error) {
 
 // ReadXML reads a xml message from the socket.
 func (s *Socket) ReadXML(v interface{}) (err error) {
-	_, r, err := s.NextReader()
-	if err != nil {
-		return err
-	}
-	return xml.NewDecoder(r).Decode(v)
+	return s.read("application/xml", v)
 }
 
 // ReadJSON reads a json message from the socket.
 func (s *Socket) ReadJSON(v interface{}) (err error) {
-	_, r, err := s.NextReader()
-	if err != nil {
-		return err
-	}
-	return codec.NewDecoder(r, &jh).Decode(v)
+	return s.read("application/json", v)
 }
 
 // ReadCBOR reads a cbor message from the socket.
 func (s *Socket) ReadCBOR(v interface{}) (err error) {
-	_, r, err := s.NextReader()
-	if err != nil {
-		return err
-	}
-	return codec.NewDecoder(r, &ch).Decode(v)
+	return s.read("application/cbor", v)
 }
 
 // ReadPACK reads a msgpack message from the socket.
 func (s *Socket) ReadPACK(v interface{}) (err error) {
-	_, r, err := s.NextReader()
-	if err != nil {
-		return err
-	}
-	return codec.NewDecoder(r, &mh).Decode(v)
+	return s.read("application/msgpack", v)
 }
 
 // Send sends a response to the socket.
@@ -234,56 +190,64 @@ func (s *Socket) SendText(data string) (err error) {
 
 // SendXML sends a xml response with status code.
 func (s *Socket) SendXML(data interface{}) (err error) {
-	w, err := s.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
-	}
-	if data != nil {
-		if err = xml.NewEncoder(w).Encode(data); err != nil {
-			return err
-		}
-	}
-	return w.Close()
+	return s.write("application/xml", data)
 }
 
 // SendJSON sends a json response with status code.
 func (s *Socket) SendJSON(data interface{}) (err error) {
-	w, err := s.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
-	}
-	if data != nil {
-		if err = codec.NewEncoder(w, &jh).Encode(data); err != nil {
-			return err
-		}
-	}
-	return w.Close()
+	return s.write("application/json", data)
 }
 
 // SendCBOR sends a cbor response with status code.
 func (s *Socket) SendCBOR(data interface{}) (err error) {
-	w, err := s.NextWriter(websocket.BinaryMessage)
-	if err != nil {
-		return err
-	}
-	if data != nil {
-		if err = codec.NewEncoder(w, &ch).Encode(data); err != nil {
-			return err
-		}
-	}
-	return w.Close()
+	return s.write("application/cbor", data)
 }
 
 // SendPACK sends a msgpack response with status code.
 func (s *Socket) SendPACK(data interface{}) (err error) {
-	w, err := s.NextWriter(websocket.BinaryMessage)
+	return s.write("application/msgpack", data)
+}
+
+func (s *Socket) read(mime string, v interface{}) error {
+	return readMessage(s.Conn, s.fibre.codecs, mime, v)
+}
+
+func (s *Socket) write(mime string, data interface{}) error {
+	return writeMessage(s.Conn, s.fibre.codecs, mime, data)
+}
+
+// readMessage reads a message from the websocket connection, decoding
+// it using the codec which has been registered for the mime type.
+func readMessage(conn *websocket.Conn, codecs *Codecs, mime string, v interface{}) error {
+	cod := codecs.Type(mime)
+	if cod == nil {
+		return fmt.Errorf("no codec registered for %q", mime)
+	}
+	_, r, err := conn.NextReader()
 	if err != nil {
 		return err
 	}
+	return cod.Decode(r, v)
+}
+
+// writeMessage sends a message to the websocket connection, encoding
+// it using the codec which has been registered for the mime type.
+// The message is encoded into a buffer first, so that nothing is
+// sent on the connection if the data can not be encoded.
+func writeMessage(conn *websocket.Conn, codecs *Codecs, mime string, data interface{}) error {
+	cod := codecs.Type(mime)
+	if cod == nil {
+		return fmt.Errorf("no codec registered for %q", mime)
+	}
+	t := websocket.BinaryMessage
+	if textual(mime) {
+		t = websocket.TextMessage
+	}
+	var buf bytes.Buffer
 	if data != nil {
-		if err = codec.NewEncoder(w, &mh).Encode(data); err != nil {
+		if err := cod.Encode(&buf, data); err != nil {
 			return err
 		}
 	}
-	return w.Close()
+	return conn.WriteMessage(t, buf.Bytes())
 }
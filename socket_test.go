@@ -0,0 +1,91 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failCodec writes part of a message before failing to encode it.
+type failCodec struct{}
+
+func (failCodec) Encode(w io.Writer, v interface{}) error {
+	w.Write([]byte("partial"))
+	return errors.New("encode failed")
+}
+
+func (failCodec) Decode(r io.Reader, v interface{}) error {
+	return errors.New("decode failed")
+}
+
+func TestSocketWriteAfterEncodeError(t *testing.T) {
+
+	f := Server()
+
+	f.Get("/socket", func(c *Context) error {
+		if err := c.Upgrade(); err != nil {
+			return err
+		}
+		defer c.Socket().Close(1000)
+		for {
+			t, b, err := c.Socket().Read()
+			if err != nil {
+				return nil
+			}
+			if err := c.Socket().Send(t, b); err != nil {
+				return nil
+			}
+		}
+	})
+
+	s := httptest.NewServer(f)
+	defer s.Close()
+
+	c, err := NewClient("ws"+strings.TrimPrefix(s.URL, "http")+"/socket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.Codecs().Register("application/x-fail", failCodec{})
+
+	if err := c.write("application/x-fail", "test"); err == nil {
+		t.Fatal("expected an encoding error")
+	}
+
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	// The partial message must never be sent, so the first
+	// message which is echoed back is the next valid message
+	if err := c.SendJSON(map[string]interface{}{"ok": true}); err != nil {
+		t.Fatalf("expected the connection to still be usable, got %v", err)
+	}
+
+	var v map[string]interface{}
+
+	if err := c.ReadJSON(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v["ok"] != true {
+		t.Errorf("expected only the valid message to be echoed, got %v", v)
+	}
+
+}
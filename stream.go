@@ -0,0 +1,319 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"net/http"
+)
+
+// errStreamClosed is returned when writing to a stream once the
+// handler which started the stream has returned.
+var errStreamClosed = errors.New("fibre: stream is closed")
+
+// Stream writes a response which is sent to the client as it is
+// written, rather than when the handler has finished. A stream can
+// be written to from several goroutines, and stops accepting writes
+// once the request has been cancelled, the client has gone away, or
+// the handler which started the stream has returned.
+type Stream struct {
+	mutex   sync.Mutex
+	closed  bool
+	writer  http.ResponseWriter
+	flusher http.Flusher
+	context context.Context
+	cancel  context.CancelFunc
+}
+
+// SSEOpts defines options for a server-sent event stream. Type is
+// the media type of the codec used to encode event data which is
+// not a string or a byte slice, and defaults to json. Retry is sent
+// to the client as the reconnection delay, if it is set. A comment
+// is sent every KeepAlive to keep the connection open, which
+// defaults to 15 seconds, or never if it is negative.
+type SSEOpts struct {
+	Type      string
+	Retry     time.Duration
+	KeepAlive time.Duration
+}
+
+// EventStream writes server-sent events to the client.
+type EventStream struct {
+	stream *Stream
+	codec  Codec
+	last   string
+	stop   chan struct{}
+	once   sync.Once
+	wait   sync.WaitGroup
+}
+
+// Stream starts a streaming response with the media type.
+func (c *Context) Stream(mime string) (*Stream, error) {
+	return c.stream(200, mime)
+}
+
+func (c *Context) stream(code int, mime string) (*Stream, error) {
+
+	f, ok := c.response.ResponseWriter.(http.Flusher)
+	if !ok {
+		return nil, NewHTTPError(500, "Streaming is not supported")
+	}
+
+	c.response.Header().Set(HeaderContentType, mime)
+	c.response.Header().Set("Cache-Control", "no-cache")
+	c.response.Header().Set("X-Accel-Buffering", "no")
+	c.response.WriteHeader(code)
+
+	f.Flush()
+
+	// The stream does not keep the context, which is
+	// returned to the pool once the handler has returned
+	s := &Stream{writer: c.response.ResponseWriter, flusher: f}
+
+	s.context, s.cancel = context.WithCancel(c.Context())
+
+	c.onFinish(s.close)
+
+	return s, nil
+
+}
+
+// Write writes the data to the stream, returning an error if the
+// stream has been closed. The data is sent on the next Flush.
+func (s *Stream) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.err(); err != nil {
+		return 0, err
+	}
+	return s.writer.Write(p)
+}
+
+// Flush sends any written data to the client.
+func (s *Stream) Flush() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err() == nil {
+		s.flusher.Flush()
+	}
+}
+
+// Done returns a channel which is closed when the request has been
+// cancelled, when the client has gone away, or when the handler
+// which started the stream has returned.
+func (s *Stream) Done() <-chan struct{} {
+	return s.context.Done()
+}
+
+// Err returns the reason the stream has been closed, or nil.
+func (s *Stream) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err()
+}
+
+func (s *Stream) err() error {
+	if s.closed {
+		return errStreamClosed
+	}
+	return s.context.Err()
+}
+
+// close stops any further writes to the stream, once the handler
+// has returned, and before the response is reused for a request.
+func (s *Stream) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	s.cancel()
+}
+
+// send writes and flushes the data as a single write.
+func (s *Stream) send(p []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.err(); err != nil {
+		return err
+	}
+	if _, err := s.writer.Write(p); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// SSE starts a server-sent event stream. A comment is sent to the
+// client periodically to keep the connection open, until the event
+// stream is closed, the handler returns, or the request is cancelled.
+func (c *Context) SSE(opts ...*SSEOpts) (*EventStream, error) {
+
+	var config *SSEOpts
+
+	switch len(opts) {
+	case 0:
+		config = &SSEOpts{}
+	default:
+		config = opts[0]
+	}
+
+	mime := config.Type
+	if mime == "" {
+		mime = "application/json"
+	}
+
+	cod := c.fibre.codecs.Type(mime)
+	if cod == nil {
+		return nil, NewHTTPError(500, fmt.Sprintf("No codec is registered for %s", mime))
+	}
+
+	s, err := c.Stream("text/event-stream")
+	if err != nil {
+		return nil, err
+	}
+
+	e := &EventStream{
+		stream: s,
+		codec:  cod,
+		last:   c.Request().Header().Get("Last-Event-ID"),
+		stop:   make(chan struct{}),
+	}
+
+	if config.Retry > 0 {
+		if err := e.Retry(config.Retry); err != nil {
+			return nil, err
+		}
+	}
+
+	wait := config.KeepAlive
+	if wait == 0 {
+		wait = 15 * time.Second
+	}
+
+	if wait > 0 {
+		e.wait.Add(1)
+		go e.keepalive(wait)
+	}
+
+	c.onFinish(e.Close)
+
+	return e, nil
+
+}
+
+// LastEventID returns the id of the last event which the client
+// received, if the client is reconnecting to the event stream.
+func (e *EventStream) LastEventID() string {
+	return e.last
+}
+
+// Send sends an event to the client. The event name and id are
+// optional. Strings and byte slices are sent as they are, and any
+// other data is encoded using the codec for the event stream.
+func (e *EventStream) Send(event, id string, data interface{}) error {
+
+	var b bytes.Buffer
+
+	if event != "" {
+		b.WriteString("event: " + clean(event) + "\n")
+	}
+
+	if id != "" {
+		b.WriteString("id: " + clean(id) + "\n")
+	}
+
+	var body []byte
+
+	switch v := data.(type) {
+	case nil:
+	case string:
+		body = []byte(v)
+	case []byte:
+		body = v
+	default:
+		var d bytes.Buffer
+		if err := e.codec.Encode(&d, v); err != nil {
+			return err
+		}
+		body = bytes.TrimRight(d.Bytes(), "\n")
+	}
+
+	for _, line := range strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(string(body)), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+
+	b.WriteString("\n")
+
+	return e.stream.send(b.Bytes())
+
+}
+
+// Retry tells the client how long to wait before reconnecting.
+func (e *EventStream) Retry(d time.Duration) error {
+	return e.stream.send([]byte(fmt.Sprintf("retry: %d\n\n", d.Milliseconds())))
+}
+
+// Comment sends a comment, which is ignored by the client.
+func (e *EventStream) Comment(text string) error {
+	return e.stream.send([]byte(": " + clean(text) + "\n\n"))
+}
+
+// Done returns a channel which is closed when the request has been
+// cancelled, or when the client has gone away.
+func (e *EventStream) Done() <-chan struct{} {
+	return e.stream.Done()
+}
+
+// Close stops sending keep-alive comments to the client. The event
+// stream is closed automatically once the handler has returned.
+func (e *EventStream) Close() {
+	e.once.Do(func() {
+		close(e.stop)
+	})
+	e.wait.Wait()
+}
+
+func (e *EventStream) keepalive(wait time.Duration) {
+
+	defer e.wait.Done()
+
+	t := time.NewTicker(wait)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-e.Done():
+			return
+		case <-t.C:
+			if e.Comment("keep-alive") != nil {
+				return
+			}
+		}
+	}
+
+}
+
+// clean removes any line breaks from an event field.
+func clean(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
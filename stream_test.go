@@ -0,0 +1,102 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSSE(t *testing.T) {
+
+	f := Server()
+
+	f.Get("/events", func(c *Context) error {
+		e, err := c.SSE(&SSEOpts{Retry: time.Second, KeepAlive: -1})
+		if err != nil {
+			return err
+		}
+		if err := e.Send("user", "1", map[string]interface{}{"id": 1}); err != nil {
+			return err
+		}
+		return e.Send("", "", "line one\nline two")
+	})
+
+	req := httptest.NewRequest(GET, "/events", nil)
+	res := httptest.NewRecorder()
+	f.ServeHTTP(res, req)
+
+	expected := "retry: 1000\n\n" +
+		"event: user\nid: 1\ndata: {\"id\":1}\n\n" +
+		"data: line one\ndata: line two\n\n"
+
+	if res.Body.String() != expected {
+		t.Errorf("expected %q, got %q", expected, res.Body.String())
+	}
+
+	if v := res.Header().Get(HeaderContentType); v != "text/event-stream" {
+		t.Errorf("expected content type text/event-stream, got %q", v)
+	}
+
+}
+
+func TestStreamClosedAfterHandler(t *testing.T) {
+
+	var stream *Stream
+
+	f := Server()
+
+	f.Get("/stream", func(c *Context) (err error) {
+		if stream == nil {
+			stream, err = c.Stream("text/plain")
+			if err != nil {
+				return err
+			}
+			_, err = stream.Write([]byte("first"))
+			return err
+		}
+		return c.Text(200, "second")
+	})
+
+	first := httptest.NewRecorder()
+	f.ServeHTTP(first, httptest.NewRequest(GET, "/stream", nil))
+
+	select {
+	case <-stream.Done():
+	default:
+		t.Errorf("expected the stream to be done once the handler returned")
+	}
+
+	second := httptest.NewRecorder()
+	f.ServeHTTP(second, httptest.NewRequest(GET, "/stream", nil))
+
+	if _, err := stream.Write([]byte("late")); err != errStreamClosed {
+		t.Errorf("expected a closed stream error, got %v", err)
+	}
+
+	if err := stream.send([]byte("late")); err != errStreamClosed {
+		t.Errorf("expected a closed stream error, got %v", err)
+	}
+
+	if first.Body.String() != "first" {
+		t.Errorf("expected %q, got %q", "first", first.Body.String())
+	}
+
+	if second.Body.String() != "second" {
+		t.Errorf("expected %q, got %q", "second", second.Body.String())
+	}
+
+}
@@ -0,0 +1,142 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+// table stores a snapshot of the routes registered with the router.
+// A table is never modified once it has been stored in the router,
+// instead a copy is modified and then stored in its place, so that
+// requests can read the current table without taking any locks.
+type table struct {
+	tree    *node
+	hosts   []*host
+	names   map[string]*Route
+	routes  []*Route
+	missing HandlerFunc
+	invalid HandlerFunc
+	replies HandlerFunc
+	cleaner HandlerFunc
+	slasher HandlerFunc
+}
+
+// load returns the current routing table.
+func (r *Router) load() *table {
+	return r.value.Load().(*table)
+}
+
+// copy returns a copy of the table which can be modified. The
+// trees are shared, and must only be modified by path copying.
+func (t *table) copy() *table {
+	c := *t
+	c.hosts = append([]*host(nil), t.hosts...)
+	c.routes = t.routes[:len(t.routes):len(t.routes)]
+	return &c
+}
+
+// copyNames returns a copy of the route names of the table.
+func (t *table) copyNames() map[string]*Route {
+	names := make(map[string]*Route, len(t.names)+1)
+	for k, v := range t.names {
+		names[k] = v
+	}
+	return names
+}
+
+// drop removes the route from the route list and route names.
+func (t *table) drop(route *Route) {
+
+	routes := make([]*Route, 0, len(t.routes))
+
+	for _, r := range t.routes {
+		if r != route {
+			routes = append(routes, r)
+		}
+	}
+
+	t.routes = routes
+
+	if route.Name != "" && t.names[route.Name] == route {
+		t.names = t.copyNames()
+		delete(t.names, route.Name)
+	}
+
+}
+
+// insert compiles the route and stores it in the table, returning
+// any route which was already stored for the same method and path.
+func (r *Router) insert(t *table, route *Route) (*Route, error) {
+
+	i, err := t.host(route)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := t.tree
+
+	if i >= 0 {
+		tree = t.hosts[i].tree
+	}
+
+	root, leaf := tree.insert(route.Path)
+
+	var old *Route
+
+	if h := leaf.routes[route.Method]; h != nil {
+		old = h.route
+	}
+
+	h := &handle{route: route, chain: r.chain(route.Handler, route.Middleware)}
+
+	// Compile a HEAD chain for GET routes
+	if route.Method == GET {
+		h.head = headChain(h.chain)
+	}
+
+	leaf.routes[route.Method] = h
+
+	if i < 0 {
+		t.tree = root
+	} else {
+		c := *t.hosts[i]
+		c.tree = root
+		t.hosts[i] = &c
+	}
+
+	return old, nil
+
+}
+
+// rebuild returns a new table with the same routes as the table,
+// recompiling the middleware chain of every route, so that any
+// change to the global middleware is applied to each route.
+func (r *Router) rebuild(t *table) *table {
+
+	n := &table{
+		tree:    new(node),
+		names:   t.names,
+		missing: r.chain(notFound, nil),
+		invalid: r.chain(notAllowed, nil),
+		replies: r.chain(autoOptions, nil),
+		cleaner: r.chain(redirectClean, nil),
+		slasher: r.chain(redirectSlash, nil),
+	}
+
+	for _, route := range t.routes {
+		r.insert(n, route)
+		n.routes = append(n.routes, route)
+	}
+
+	return n
+
+}
@@ -0,0 +1,335 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"strings"
+)
+
+// node is a single edge in the compressed prefix tree used
+// by the router. Static children are matched first, then any
+// single path segment parameters, and finally a match all.
+// Parameters with a constraint are tested before parameters
+// without one, so that an unconstrained parameter is a fallback.
+type node struct {
+	prefix  string
+	cons    string
+	check   func(string) bool
+	statics []*node
+	params  []*node
+	any     *node
+	routes  map[string]*handle
+}
+
+// handle stores a route in the tree, along with its compiled
+// middleware chain, and the chain used for HEAD requests.
+type handle struct {
+	route *Route
+	chain HandlerFunc
+	head  HandlerFunc
+}
+
+// clone returns a shallow copy of the node, with its own copy
+// of the child slices and the route map, so that the copy can
+// be modified without affecting any reader of the original.
+func (n *node) clone() *node {
+	c := *n
+	c.statics = append([]*node(nil), n.statics...)
+	c.params = append([]*node(nil), n.params...)
+	c.routes = make(map[string]*handle, len(n.routes))
+	for k, v := range n.routes {
+		c.routes[k] = v
+	}
+	return &c
+}
+
+// insert adds the path to a copy of the tree, returning the root
+// of the copied tree and the node at which the route handlers for
+// the path should be stored. Only the nodes along the path are
+// copied, and the original tree is never modified, so that it can
+// still be read concurrently while the copy is being built.
+func (n *node) insert(path string) (root, leaf *node) {
+
+	root = n.clone()
+
+	n = root
+
+	for len(path) > 0 {
+
+		switch path[0] {
+
+		case ':':
+			_, cons, i := parameter(path)
+			n, path = n.param(cons), path[i:]
+
+		case '*':
+			if n.any == nil {
+				n.any = new(node)
+			} else {
+				n.any = n.any.clone()
+			}
+			n, path = n.any, ""
+
+		default:
+			i := strings.IndexAny(path, ":*")
+			if i < 0 {
+				i = len(path)
+			}
+			n, path = n.static(path[:i]), path[i:]
+
+		}
+
+	}
+
+	if n.routes == nil {
+		n.routes = make(map[string]*handle)
+	}
+
+	return root, n
+
+}
+
+// get returns the node for the path without modifying the
+// tree, or nil if the path has not been added to the tree.
+func (n *node) get(path string) *node {
+
+	for n != nil && len(path) > 0 {
+
+		switch path[0] {
+
+		case ':':
+			_, cons, i := parameter(path)
+			var next *node
+			for _, child := range n.params {
+				if child.cons == cons {
+					next = child
+					break
+				}
+			}
+			n, path = next, path[i:]
+
+		case '*':
+			n, path = n.any, ""
+
+		default:
+			var next *node
+			for _, child := range n.statics {
+				if strings.HasPrefix(path, child.prefix) {
+					next = child
+					break
+				}
+			}
+			if next == nil {
+				return nil
+			}
+			n, path = next, path[len(next.prefix):]
+
+		}
+
+	}
+
+	return n
+
+}
+
+// param adds a path segment parameter below the node, reusing
+// a copy of any existing parameter with the same constraint.
+func (n *node) param(cons string) *node {
+
+	for i, child := range n.params {
+		if child.cons == cons {
+			n.params[i] = child.clone()
+			return n.params[i]
+		}
+	}
+
+	check, _ := constraint(cons)
+
+	child := &node{cons: cons, check: check}
+
+	switch {
+	case cons == "":
+		n.params = append(n.params, child)
+	default:
+		i := len(n.params)
+		if i > 0 && n.params[i-1].cons == "" {
+			i--
+		}
+		n.params = append(n.params, nil)
+		copy(n.params[i+1:], n.params[i:])
+		n.params[i] = child
+	}
+
+	return child
+
+}
+
+// static adds a static path prefix below the node, splitting
+// any existing edge which shares a common prefix with it.
+func (n *node) static(path string) *node {
+
+	for len(path) > 0 {
+
+		var child *node
+		var index int
+
+		for i, c := range n.statics {
+			if c.prefix[0] == path[0] {
+				child, index = c, i
+				break
+			}
+		}
+
+		if child == nil {
+			child = &node{prefix: path}
+			n.statics = append(n.statics, child)
+			return child
+		}
+
+		l := commonPrefix(child.prefix, path)
+
+		if l < len(child.prefix) {
+			tail := child.clone()
+			tail.prefix = child.prefix[l:]
+			child = &node{prefix: child.prefix[:l], statics: []*node{tail}}
+		} else {
+			child = child.clone()
+		}
+
+		n.statics[index] = child
+
+		n, path = child, path[l:]
+
+	}
+
+	return n
+
+}
+
+// find walks the tree for the path, returning the matching
+// route for the method along with the captured parameters.
+// The param slice is only appended to, so that a caller can
+// pass a reusable buffer and avoid allocating on each lookup.
+// When fold is true, static edges are compared ignoring case.
+// When slash is true, the path is matched as if it ended with
+// an extra slash, without building the longer path string.
+func (n *node) find(meth, path string, vals []string, fold, slash bool) (*handle, []string) {
+
+	if len(path) == 0 && !slash {
+		if h := n.routes[meth]; h != nil {
+			return h, vals
+		}
+	}
+
+	for _, child := range n.statics {
+		if !fold && child.prefix[0] != next(path) {
+			continue
+		}
+		switch {
+		case len(child.prefix) <= len(path):
+			if !hasPrefix(path, child.prefix, fold) {
+				continue
+			}
+			if h, v := child.find(meth, path[len(child.prefix):], vals, fold, slash); h != nil {
+				return h, v
+			}
+		case slash && len(child.prefix) == len(path)+1:
+			if child.prefix[len(path)] != '/' || !hasPrefix(child.prefix, path, fold) {
+				continue
+			}
+			if h, v := child.find(meth, "", vals, fold, false); h != nil {
+				return h, v
+			}
+		}
+		if !fold {
+			break
+		}
+	}
+
+	if len(n.params) > 0 && len(path) > 0 {
+		i := strings.IndexByte(path, '/')
+		if i < 0 {
+			i = len(path)
+		}
+		if i > 0 {
+			for _, child := range n.params {
+				if child.check != nil && !child.check(path[:i]) {
+					continue
+				}
+				if h, v := child.find(meth, path[i:], append(vals, path[:i]), fold, slash); h != nil {
+					return h, v
+				}
+			}
+		}
+	}
+
+	if n.any != nil {
+		if h := n.any.routes[meth]; h != nil {
+			if slash {
+				path += "/"
+			}
+			return h, append(vals, path)
+		}
+	}
+
+	return nil, nil
+
+}
+
+// next returns the next byte of the path, or the slash which
+// ends the path when the path is matched with a trailing slash.
+func next(path string) byte {
+	if len(path) == 0 {
+		return '/'
+	}
+	return path[0]
+}
+
+// hasPrefix tests whether the string begins with the prefix,
+// ignoring the case of any ascii letters when fold is true.
+func hasPrefix(s, prefix string, fold bool) bool {
+	if fold {
+		return hasPrefixFold(s, prefix)
+	}
+	return strings.HasPrefix(s, prefix)
+}
+
+// hasPrefixFold tests whether the string begins with the
+// prefix, ignoring the case of any ascii letters.
+func hasPrefixFold(s, prefix string) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i := 0; i < len(prefix); i++ {
+		a, b := s[i], prefix[i]
+		if a >= 'A' && a <= 'Z' {
+			a += 'a' - 'A'
+		}
+		if b >= 'A' && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		if a != b {
+			return false
+		}
+	}
+	return true
+}
+
+func commonPrefix(a, b string) (i int) {
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return
+}
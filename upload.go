@@ -0,0 +1,281 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"mime/multipart"
+)
+
+// maxMemory is the amount of a multipart form which is kept in
+// memory when the form is parsed, with the rest stored on disk.
+const maxMemory = 32 << 20
+
+// maxValueSize is the default size limit of each form value in
+// a multipart upload, which is read into memory to be stored.
+const maxValueSize = 1 << 20
+
+// UploadOpts defines options for streaming a multipart upload. Files
+// are written to a new temporary file in Dir, or in the default
+// directory for temporary files if Dir is empty. If Writer is set,
+// it is called for each file instead, and the file is written to
+// the returned writer. A MaxFileSize or MaxTotalSize of zero means
+// that the size of each file, or of the whole upload, is unlimited.
+// Form values are held in memory, so each value is limited to the
+// MaxValueSize, or to 1MB if it is zero, and all of the values
+// together are limited to 32MB.
+type UploadOpts struct {
+	Dir          string
+	Writer       func(part *multipart.Part) (io.Writer, error)
+	MaxFileSize  int64
+	MaxValueSize int64
+	MaxTotalSize int64
+}
+
+// Upload describes a file which has been streamed from a multipart
+// upload. Path is the path of the temporary file which the file was
+// written to, and is empty if the file was written to a Writer. The
+// temporary file is not removed once the request has finished, so
+// it must be removed by the caller once it is no longer needed.
+type Upload struct {
+	Field    string
+	Filename string
+	Type     string
+	Size     int64
+	Path     string
+}
+
+// FormFile returns the multipart form file for the form field name.
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+
+	if err := c.parseForm(); err != nil {
+		return nil, err
+	}
+
+	if c.request.MultipartForm != nil {
+		if files := c.request.MultipartForm.File[name]; len(files) > 0 {
+			return files[0], nil
+		}
+	}
+
+	return nil, NewHTTPError(400, fmt.Sprintf("Form file '%s' is required", name)).WithField("form", name)
+
+}
+
+// MultipartReader returns a reader for streaming the parts of a
+// multipart request body, without buffering it in memory or on disk.
+func (c *Context) MultipartReader() (*multipart.Reader, error) {
+	r, err := c.request.MultipartReader()
+	if err != nil {
+		return nil, NewHTTPError(400, err.Error())
+	}
+	return r, nil
+}
+
+// Upload streams each file in the multipart request body to a file
+// or writer, so that the upload is never held entirely in memory.
+// Any other form values are stored, so that they can be retrieved
+// using Context.Form. If a size limit is exceeded, a 413 error is
+// returned, and any temporary files which were written are removed.
+func (c *Context) Upload(opts UploadOpts) (files []*Upload, err error) {
+
+	defer func() {
+		if err != nil {
+			for _, f := range files {
+				if f.Path != "" {
+					os.Remove(f.Path)
+				}
+			}
+			files = nil
+		}
+	}()
+
+	r, err := c.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.request.Form == nil {
+		c.request.Form = c.Request().Request.URL.Query()
+	}
+
+	var total, values int64
+
+	for {
+
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, NewHTTPError(400, err.Error())
+		}
+
+		limit := int64(-1)
+
+		if opts.MaxTotalSize > 0 {
+			limit = opts.MaxTotalSize - total
+		}
+
+		if opts.MaxFileSize > 0 && part.FileName() != "" && (limit < 0 || opts.MaxFileSize < limit) {
+			limit = opts.MaxFileSize
+		}
+
+		if part.FileName() == "" {
+			n, err := c.uploadValue(part, valueLimit(opts, limit, values))
+			total += n
+			values += n
+			if err != nil {
+				return files, err
+			}
+			continue
+		}
+
+		f, err := c.uploadFile(part, opts, limit)
+		if f != nil {
+			files = append(files, f)
+			total += f.Size
+		}
+		if err != nil {
+			return files, err
+		}
+
+	}
+
+}
+
+// valueLimit returns the size limit for the next form value, which
+// is the smallest of the value limit, the memory remaining for all
+// of the form values, and the limit remaining for the whole upload.
+func valueLimit(opts UploadOpts, limit, values int64) int64 {
+
+	max := opts.MaxValueSize
+
+	if max <= 0 {
+		max = maxValueSize
+	}
+
+	if max > maxMemory-values {
+		max = maxMemory - values
+	}
+
+	if limit >= 0 && limit < max {
+		max = limit
+	}
+
+	return max
+
+}
+
+func (c *Context) uploadValue(part *multipart.Part, limit int64) (int64, error) {
+
+	defer part.Close()
+
+	val, err := ioutil.ReadAll(limitReader(part, limit))
+	if err != nil {
+		return 0, NewHTTPError(400, err.Error())
+	}
+
+	if limit >= 0 && int64(len(val)) > limit {
+		return 0, uploadError(part.FormName())
+	}
+
+	c.request.Form.Add(part.FormName(), string(val))
+
+	return int64(len(val)), nil
+
+}
+
+func (c *Context) uploadFile(part *multipart.Part, opts UploadOpts, limit int64) (*Upload, error) {
+
+	defer part.Close()
+
+	f := &Upload{
+		Field:    part.FormName(),
+		Filename: part.FileName(),
+		Type:     part.Header.Get(HeaderContentType),
+	}
+
+	var w io.Writer
+
+	if opts.Writer != nil {
+		var err error
+		if w, err = opts.Writer(part); err != nil {
+			return nil, err
+		}
+	} else {
+		tmp, err := ioutil.TempFile(opts.Dir, "fibre-upload-")
+		if err != nil {
+			return nil, err
+		}
+		defer tmp.Close()
+		w, f.Path = tmp, tmp.Name()
+	}
+
+	n, err := io.Copy(w, limitReader(part, limit))
+
+	f.Size = n
+
+	if err != nil {
+		return f, err
+	}
+
+	if limit >= 0 && n > limit {
+		return f, uploadError(f.Field)
+	}
+
+	return f, nil
+
+}
+
+// parseForm parses the request body as a form, using a multipart
+// form parser if the request body is a multipart form.
+func (c *Context) parseForm() error {
+
+	if c.Type() == "multipart/form-data" {
+		if err := c.request.ParseMultipartForm(maxMemory); err != nil {
+			if err == multipart.ErrMessageTooLarge {
+				return NewHTTPError(413)
+			}
+			return NewHTTPError(400, err.Error())
+		}
+		return nil
+	}
+
+	if err := c.request.ParseForm(); err != nil {
+		return NewHTTPError(400, err.Error())
+	}
+
+	return nil
+
+}
+
+// limitReader reads at most one byte more than the limit, so that
+// a reader which exceeds the limit can be detected, or reads all of
+// the reader if the limit is negative.
+func limitReader(r io.Reader, limit int64) io.Reader {
+	if limit < 0 {
+		return r
+	}
+	return io.LimitReader(r, limit+1)
+}
+
+func uploadError(name string) *HTTPError {
+	return NewHTTPError(413, fmt.Sprintf("Form field '%s' is too large", name)).WithField("form", name)
+}
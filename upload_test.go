@@ -0,0 +1,141 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"mime/multipart"
+)
+
+// testMultipart returns a multipart body with the form values
+// and files, along with the content type of the body.
+func testMultipart(values, files map[string]string) (*bytes.Buffer, string) {
+	b := new(bytes.Buffer)
+	w := multipart.NewWriter(b)
+	for k, v := range values {
+		w.WriteField(k, v)
+	}
+	for k, v := range files {
+		f, _ := w.CreateFormFile(k, k+".txt")
+		f.Write([]byte(v))
+	}
+	w.Close()
+	return b, w.FormDataContentType()
+}
+
+func TestUpload(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "fibre-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name   string
+		opts   UploadOpts
+		values map[string]string
+		files  map[string]string
+		code   int
+	}{
+		{
+			name:   "small",
+			values: map[string]string{"name": "tobie"},
+			files:  map[string]string{"file": "contents"},
+			code:   200,
+		},
+		{
+			name:   "file too large",
+			opts:   UploadOpts{MaxFileSize: 4},
+			values: map[string]string{"name": "tobie"},
+			files:  map[string]string{"file": "contents"},
+			code:   413,
+		},
+		{
+			name:   "value too large for file limit",
+			opts:   UploadOpts{MaxFileSize: 4},
+			values: map[string]string{"name": strings.Repeat("a", maxValueSize+1)},
+			code:   413,
+		},
+		{
+			name:   "value too large for value limit",
+			opts:   UploadOpts{MaxValueSize: 4},
+			values: map[string]string{"name": "tobie"},
+			code:   413,
+		},
+		{
+			name:   "value within value limit",
+			opts:   UploadOpts{MaxValueSize: 2 * maxValueSize},
+			values: map[string]string{"name": strings.Repeat("a", maxValueSize+1)},
+			code:   200,
+		},
+		{
+			name:   "total too large",
+			opts:   UploadOpts{MaxTotalSize: 10},
+			values: map[string]string{"name": "tobie"},
+			files:  map[string]string{"file": "contents"},
+			code:   413,
+		},
+	}
+
+	for _, test := range tests {
+
+		var uploads []*Upload
+
+		f := Server()
+
+		f.Post("/upload", func(c *Context) (err error) {
+			opts := test.opts
+			opts.Dir = dir
+			if uploads, err = c.Upload(opts); err != nil {
+				return err
+			}
+			if c.Form("name") != test.values["name"] {
+				t.Errorf("%s: expected the form value to be stored", test.name)
+			}
+			return c.Code(200)
+		})
+
+		body, mime := testMultipart(test.values, test.files)
+		req := httptest.NewRequest(POST, "/upload", body)
+		req.Header.Set(HeaderContentType, mime)
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, req)
+
+		if res.Code != test.code {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.code, res.Code)
+		}
+
+		for _, u := range uploads {
+			if b, err := ioutil.ReadFile(u.Path); err != nil || string(b) != test.files[u.Field] {
+				t.Errorf("%s: expected file %q to be written, got %q %v", test.name, u.Field, b, err)
+			}
+			os.Remove(u.Path)
+		}
+
+	}
+
+	// Temporary files are removed when the upload fails
+	if names, _ := ioutil.ReadDir(dir); len(names) != 0 {
+		t.Errorf("expected no temporary files to remain, got %d", len(names))
+	}
+
+}
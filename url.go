@@ -15,6 +15,7 @@
 package fibre
 
 import (
+	"net"
 	"net/url"
 	"strings"
 )
@@ -25,43 +26,119 @@ type URL struct {
 	User     string
 	Pass     string
 	Host     string
+	Port     string
 	Path     string
 	Query    string
 	Fragment string
 }
 
 // NewURL parses and returns a new URL object
-func NewURL(tls bool, uri string) *URL {
+func NewURL(tls bool, uri string) (*URL, error) {
 
-	var user string
-	var pass string
-	var host string
-
-	var part *url.URL
+	scheme := "http"
 
-	if tls == true {
-		part, _ = url.Parse("https://" + uri)
+	if tls {
+		scheme = "https"
 	}
 
-	if tls == false {
-		part, _ = url.Parse("http://" + uri)
+	part, err := url.Parse(scheme + "://" + uri)
+	if err != nil {
+		return nil, err
 	}
 
+	return newURL(scheme, part.Host, part), nil
+
+}
+
+// newURL returns a new URL object for the parsed url, using
+// the scheme and host specified instead of those in the url.
+func newURL(scheme, host string, part *url.URL) *URL {
+
+	var user string
+	var pass string
+
 	if part.User != nil {
 		user = part.User.Username()
 		pass, _ = part.User.Password()
 	}
 
-	host = strings.SplitN(part.Host, ":", 2)[0]
+	host, port := splitHost(host)
 
 	return &URL{
-		Scheme:   part.Scheme,
+		Scheme:   scheme,
 		User:     user,
 		Pass:     pass,
 		Host:     host,
+		Port:     port,
 		Path:     part.Path,
 		Query:    part.RawQuery,
 		Fragment: part.Fragment,
 	}
 
 }
+
+// String returns the url as an absolute url.
+func (u *URL) String() string {
+
+	v := url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.hostport(),
+		Path:     u.Path,
+		RawQuery: u.Query,
+		Fragment: u.Fragment,
+	}
+
+	switch {
+	case u.Pass != "":
+		v.User = url.UserPassword(u.User, u.Pass)
+	case u.User != "":
+		v.User = url.User(u.User)
+	}
+
+	return v.String()
+
+}
+
+// Origin returns the scheme, host and port of the url.
+func (u *URL) Origin() string {
+	return u.Scheme + "://" + u.hostport()
+}
+
+// Resolve returns the absolute url for a reference, such as a
+// path, relative to the url, for use in redirects and links.
+func (u *URL) Resolve(ref string) (string, error) {
+
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := url.Parse(u.String())
+	if err != nil {
+		return "", err
+	}
+
+	return b.ResolveReference(r).String(), nil
+
+}
+
+// hostport joins the host and port, adding brackets around an
+// ipv6 address, and leaving out the port if it is not set.
+func (u *URL) hostport() string {
+	if u.Port == "" {
+		if strings.Contains(u.Host, ":") {
+			return "[" + u.Host + "]"
+		}
+		return u.Host
+	}
+	return net.JoinHostPort(u.Host, u.Port)
+}
+
+// splitHost splits the host into the host name and the port,
+// removing any brackets from around an ipv6 address.
+func splitHost(h string) (host, port string) {
+	if host, port, err := net.SplitHostPort(h); err == nil {
+		return host, port
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(h, "["), "]"), ""
+}
@@ -0,0 +1,342 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"net/mail"
+	"net/url"
+)
+
+// ValidatorFunc checks whether a value satisfies a validation rule,
+// which is passed any parameter specified with the rule in the tag,
+// such as `5` in `min=5`. The error message is used as the message
+// for the field in the validation error.
+type ValidatorFunc func(v reflect.Value, param string) error
+
+// validators stores the builtin rules for `validate` struct tags.
+var validators = map[string]ValidatorFunc{
+	"min":   validateMin,
+	"max":   validateMax,
+	"len":   validateLen,
+	"oneof": validateOneOf,
+	"email": validateEmail,
+	"url":   validateURL,
+	"uuid":  validateString(isUUID, "must be a uuid"),
+	"alpha": validateString(isAlpha, "must contain only letters"),
+	"alnum": validateString(isAlnum, "must contain only letters and numbers"),
+}
+
+// SetValidator registers a custom rule for `validate` struct tags,
+// replacing any builtin rule with the same name.
+func (f *Fibre) SetValidator(name string, fn ValidatorFunc) {
+	if f.validators == nil {
+		f.validators = make(map[string]ValidatorFunc)
+	}
+	f.validators[name] = fn
+}
+
+// Validate checks the object against the rules in its `validate`
+// struct tags, such as `validate:"required,min=1,max=64"`. Nested
+// structs, slices and maps are checked too. If any field fails a
+// rule, a 422 error is returned, with a field for each failure,
+// keyed by the path of the field using its json name. A field with
+// a json name of "-" is still checked, and is keyed by its param,
+// query, header or form name, or by its Go name. If a tag is
+// invalid, such as one with an unknown rule, the problem is logged
+// and a 500 error is returned.
+func (c *Context) Validate(i interface{}) error {
+
+	errs := make(map[string]interface{})
+
+	if err := c.fibre.validate(reflect.ValueOf(i), "", errs); err != nil {
+		c.fibre.Logger().Errorf("%v", err)
+		return NewHTTPError(500)
+	}
+
+	if len(errs) > 0 {
+		return NewHTTPError(422).WithFields(errs)
+	}
+
+	return nil
+
+}
+
+// ruleError describes a validation tag which can not be checked,
+// because it uses an unknown rule or a rule has an invalid param.
+type ruleError struct {
+	field  string
+	reason string
+}
+
+func (e *ruleError) Error() string {
+	return fmt.Sprintf("fibre: validate tag on field %q %s", e.field, e.reason)
+}
+
+func (f *Fibre) validate(v reflect.Value, path string, errs map[string]interface{}) error {
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" && !field.Anonymous {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				name = field.Name
+				for _, s := range sources {
+					if tag := field.Tag.Get(s[0]); tag != "" && tag != "-" {
+						name = tag
+						break
+					}
+				}
+			}
+			p := path
+			if name != "" || !field.Anonymous {
+				if name == "" {
+					name = field.Name
+				}
+				if p != "" {
+					p += "."
+				}
+				p += name
+			}
+			if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+				if err := f.check(v.Field(i), tag); err != nil {
+					if e, ok := err.(*ruleError); ok {
+						e.field = t.String() + "." + field.Name
+						return e
+					}
+					errs[p] = err.Error()
+					continue
+				}
+			}
+			if err := f.validate(v.Field(i), p, errs); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := f.validate(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			for _, k := range v.MapKeys() {
+				p := k.String()
+				if path != "" {
+					p = path + "." + p
+				}
+				if err := f.validate(v.MapIndex(k), p, errs); err != nil {
+					return err
+				}
+			}
+		}
+
+	}
+
+	return nil
+
+}
+
+// check tests the value against each of the rules in the tag,
+// returning the error from the first rule which is not satisfied,
+// or a ruleError if the tag itself is invalid.
+func (f *Fibre) check(v reflect.Value, tag string) error {
+
+	rules := strings.Split(tag, ",")
+
+	for _, rule := range rules {
+		if rule == "omitempty" && v.IsZero() {
+			return nil
+		}
+	}
+
+	for _, rule := range rules {
+
+		name, param := rule, ""
+
+		if i := strings.IndexByte(rule, '='); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+
+		switch name {
+		case "", "omitempty":
+			continue
+		case "required":
+			if v.IsZero() {
+				return errors.New("is required")
+			}
+			continue
+		}
+
+		fn, ok := f.validators[name]
+		if !ok {
+			fn, ok = validators[name]
+		}
+		if !ok {
+			return &ruleError{reason: fmt.Sprintf("uses unknown rule %q", name)}
+		}
+
+		e := v
+		for e.Kind() == reflect.Ptr || e.Kind() == reflect.Interface {
+			if e.IsNil() {
+				return nil
+			}
+			e = e.Elem()
+		}
+
+		if err := fn(e, param); err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+
+}
+
+func validateMin(v reflect.Value, param string) error {
+	p, err := parseParam("min", param)
+	if err != nil {
+		return err
+	}
+	if n, ok := number(v); ok {
+		if n < p {
+			return fmt.Errorf("must be at least %s", param)
+		}
+	} else if n, ok := length(v); ok {
+		if float64(n) < p {
+			return fmt.Errorf("must have a length of at least %s", param)
+		}
+	}
+	return nil
+}
+
+func validateMax(v reflect.Value, param string) error {
+	p, err := parseParam("max", param)
+	if err != nil {
+		return err
+	}
+	if n, ok := number(v); ok {
+		if n > p {
+			return fmt.Errorf("must be at most %s", param)
+		}
+	} else if n, ok := length(v); ok {
+		if float64(n) > p {
+			return fmt.Errorf("must have a length of at most %s", param)
+		}
+	}
+	return nil
+}
+
+func validateLen(v reflect.Value, param string) error {
+	p, err := parseParam("len", param)
+	if err != nil {
+		return err
+	}
+	if n, ok := length(v); ok {
+		if float64(n) != p {
+			return fmt.Errorf("must have a length of %s", param)
+		}
+	}
+	return nil
+}
+
+func validateOneOf(v reflect.Value, param string) error {
+	s := fmt.Sprint(v.Interface())
+	for _, o := range strings.Fields(param) {
+		if s == o {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(strings.Fields(param), ", "))
+}
+
+func validateEmail(v reflect.Value, param string) error {
+	if v.Kind() == reflect.String {
+		if a, err := mail.ParseAddress(v.String()); err != nil || a.Address != v.String() {
+			return errors.New("must be a valid email address")
+		}
+	}
+	return nil
+}
+
+func validateURL(v reflect.Value, param string) error {
+	if v.Kind() == reflect.String {
+		if u, err := url.ParseRequestURI(v.String()); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("must be a valid url")
+		}
+	}
+	return nil
+}
+
+func validateString(fn func(string) bool, msg string) ValidatorFunc {
+	return func(v reflect.Value, param string) error {
+		if v.Kind() == reflect.String && !fn(v.String()) {
+			return errors.New(msg)
+		}
+		return nil
+	}
+}
+
+func parseParam(rule, param string) (float64, error) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return 0, &ruleError{reason: fmt.Sprintf("rule %q requires a number, not %q", rule, param)}
+	}
+	return n, nil
+}
+
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func length(v reflect.Value) (int, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len(), true
+	}
+	return 0, false
+}
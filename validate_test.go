@@ -0,0 +1,171 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fibre
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"net/http/httptest"
+)
+
+type testAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type testUser struct {
+	Name    string        `json:"name" validate:"required,min=2,max=8"`
+	Email   string        `json:"email" validate:"omitempty,email"`
+	Role    string        `json:"role" validate:"oneof=admin user"`
+	Tags    []string      `json:"tags" validate:"max=2"`
+	Address testAddress   `json:"address"`
+	Others  []testAddress `json:"others"`
+}
+
+func TestValidate(t *testing.T) {
+
+	f := Server()
+
+	c := NewContext(new(Request), new(Response), f)
+
+	tests := []struct {
+		name   string
+		value  interface{}
+		fields map[string]interface{}
+	}{
+		{
+			name:  "valid",
+			value: &testUser{Name: "tobie", Role: "admin", Address: testAddress{City: "London"}},
+		},
+		{
+			name:  "invalid",
+			value: &testUser{Name: "t", Email: "nope", Role: "other", Tags: []string{"a", "b", "c"}, Others: []testAddress{{}}},
+			fields: map[string]interface{}{
+				"name":           "must have a length of at least 2",
+				"email":          "must be a valid email address",
+				"role":           "must be one of admin, user",
+				"tags":           "must have a length of at most 2",
+				"address.city":   "is required",
+				"others[0].city": "is required",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		err := c.Validate(test.value)
+		if test.fields == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		he, ok := err.(*HTTPError)
+		if !ok || he.Code() != 422 {
+			t.Errorf("%s: expected a 422 error, got %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(he.Fields(), test.fields) {
+			t.Errorf("%s: expected fields %v, got %v", test.name, test.fields, he.Fields())
+		}
+	}
+
+}
+
+func TestValidateInvalidTags(t *testing.T) {
+
+	f := Server()
+
+	f.Logger().Out = io.Discard
+
+	c := NewContext(new(Request), new(Response), f)
+
+	tests := []interface{}{
+		&struct {
+			Name string `validate:"required,unknown"`
+		}{"tobie"},
+		&struct {
+			Name string `validate:"min=two"`
+		}{"tobie"},
+		&struct {
+			Items []struct {
+				Size int `validate:"len=x"`
+			}
+		}{Items: make([]struct {
+			Size int `validate:"len=x"`
+		}, 1)},
+	}
+
+	for i, test := range tests {
+		err := c.Validate(test)
+		if he, ok := err.(*HTTPError); !ok || he.Code() != 500 {
+			t.Errorf("test %d: expected a 500 error, got %v", i, err)
+		}
+	}
+
+}
+
+func TestValidateHiddenFields(t *testing.T) {
+
+	f := Server()
+
+	var err error
+
+	f.Get("/b/:id", func(c *Context) error {
+		var v struct {
+			ID   int    `param:"id" json:"-" validate:"min=1"`
+			Tag  string `query:"tag" json:"-" validate:"max=3"`
+			Note string `json:"-" validate:"max=3"`
+		}
+		v.Note = c.Query("note")
+		if err = c.Bind(&v); err != nil {
+			return err
+		}
+		return c.Code(200)
+	})
+
+	tests := []struct {
+		path   string
+		code   int
+		fields []string
+	}{
+		{"/b/1?tag=abc", 200, nil},
+		{"/b/0", 422, []string{"id"}},
+		{"/b/1?tag=abcd", 422, []string{"tag"}},
+		{"/b/0?tag=abcd&note=abcd", 422, []string{"id", "tag", "Note"}},
+	}
+
+	for _, test := range tests {
+		res := httptest.NewRecorder()
+		f.ServeHTTP(res, httptest.NewRequest(GET, test.path, nil))
+		if res.Code != test.code {
+			t.Errorf("%s: expected code %d, got %d", test.path, test.code, res.Code)
+			continue
+		}
+		if test.code == 200 {
+			continue
+		}
+		he := err.(*HTTPError)
+		if len(he.Fields()) != len(test.fields) {
+			t.Errorf("%s: expected fields %v, got %v", test.path, test.fields, he.Fields())
+		}
+		for _, k := range test.fields {
+			if _, ok := he.Fields()[k]; !ok {
+				t.Errorf("%s: expected an error for field %q, got %v", test.path, k, he.Fields())
+			}
+		}
+	}
+
+}